@@ -6,49 +6,111 @@ import (
 )
 
 var embeddedAgentConfig = models.DNSRequest{
-	Header:   Header,
-	Question: Question,
-	Resolver: Resolver,
-	Answers:  Answers,
+	Header:          Header,
+	Question:        Question,
+	Questions:       Questions,
+	Resolver:        Resolver,
+	Answers:         Answers,
+	Authority:       Authority,
+	Additional:      Additional,
+	Update:          Update,
+	Transfer:        Transfer,
+	Capture:         Capture,
+	EDNS:            EDNS,
+	Compression:     Compression,
+	AllowViolations: false,
+	DNSSEC:          DNSSEC,
+	TSIG:            TSIG,
+	Size:            Size,
+	Patches:         Patches,
 }
 
 var Header = models.Header{
 	ID:                 54321,
+	IDStrategy:         nil,
 	QR:                 true,
 	OpCode:             "QUERY",
+	StdOpCode:          true,
+	CustomOpCode:       0,
 	Authoritative:      false,
 	Truncated:          false,
 	RecursionDesired:   true,
 	RecursionAvailable: true,
-	Z:                  6,
+	AuthenticatedData:  true,
+	CheckingDisabled:   false,
+	Z:                  1,
 	RCode:              0,
+	CountOverrides:     nil,
 }
 
 var Question = models.Question{
 	Name:        "data.malicious.com.",
 	Type:        "TXT",
+	StdType:     true,
+	CustomType:  0,
 	Class:       "NO",
 	StdClass:    false,
 	CustomClass: 67,
 }
 
+var Questions = []models.Question{}
+
 var Resolver = models.Resolver{
 	UseSystemDefaults: false,
 	IP:                "1.1.1.1",
 	Port:              53,
+	Transport:         "",
+	TCP:               nil,
 }
 
 var Answers = []models.Answer{
 	{
-		Name:  "data.malicious.com.",
-		Type:  "TXT",
-		Class: "NO",
-		TTL:   300,
-		Data:  "48656c6c6f20576f726c64212048657820656e636f646564206461746120666f722074657374696e6720444e53207475a3bd656c696e672e2054686973206973206120636f6d6d6f6e20746563686e69717565207573656420666f7220646174612065786663696c7472617465696f6e2e77a4",
+		Name:        "data.malicious.com.",
+		Type:        "TXT",
+		Class:       "NO",
+		StdClass:    true,
+		CustomClass: 0,
+		CacheFlush:  false,
+		TTL:         300,
+		Data:        "48656c6c6f20576f726c64212048657820656e636f646564206461746120666f722074657374696e6720444e53207475a3bd656c696e672e2054686973206973206120636f6d6d6f6e20746563686e69717565207573656420666f7220646174612065786663696c7472617465696f6e2e77a4",
+		TypeCode:    0,
+		RawRData:    "",
 	},
 }
 
+var Authority = []models.Answer{}
+
+var Additional = []models.Answer{}
+
+var EDNS = (*models.EDNS)(nil)
+
+var Transfer = (*models.Transfer)(nil)
+
+var Size = (*models.SizePolicy)(nil)
+
+var Capture = (*models.Capture)(nil)
+
+var Update = (*models.Update)(nil)
+
+var Compression = (*models.Compression)(nil)
+
+var DNSSEC = (*models.DNSSEC)(nil)
+
+var TSIG = (*models.TSIG)(nil)
+
+var Patches = []models.Patch{}
+
 // getEmbeddedAgentConfig is called by the agent's main.go to retrieve this configuration.
 func getEmbeddedAgentConfig() models.DNSRequest {
 	return embeddedAgentConfig
 }
+
+// uint16Ptr is used for optional fields, where 0 is a meaningful value.
+func uint16Ptr(v uint16) *uint16 {
+	return &v
+}
+
+// int64Ptr is used for optional fields, where 0 is a meaningful value.
+func int64Ptr(v int64) *int64 {
+	return &v
+}
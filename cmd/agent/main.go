@@ -1,44 +1,70 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
+	"github.com/faanross/spinnekop/internal/capture"
 	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
 	"github.com/faanross/spinnekop/internal/network"
 	"github.com/faanross/spinnekop/internal/utils"
 	"github.com/faanross/spinnekop/internal/visualizer"
 	"github.com/fatih/color"
 	"github.com/miekg/dns"
+	"time"
+)
+
+const (
+	defaultTransferOutput  = "transfer.zone"  // Zone file a transfer is written to, unless the config says otherwise
+	defaultTransferTimeout = 10 * time.Second // Time to wait for every message of a transfer
 )
 
 func main() {
 
-	// Load our config from config.go
-	dnsRequest := getEmbeddedAgentConfig()
+	// Load our config from config.go, and expand its placeholders for this message
+	config := getEmbeddedAgentConfig()
+	expander := crafter.NewExpander()
+	if crafter.UsesSendCount(config) || crafter.PositionalIDs(config.Header) {
+		// The send count is kept in a file next to the binary, so it carries over between runs
+		defer resumeSendCount(expander)()
+	}
+
+	// The messages sent so far tell us where we are in the ID strategy's series,
+	// so every run takes the next ID rather than starting over at the first one
+	ids := crafter.NewIDSequence(config.Header)
+	id := ids.At(expander.Sent())
 
-	// Create our dns.Msg structure (miekg/dns)
-	dnsMsg, err := crafter.BuildDNSRequest(dnsRequest)
+	dnsRequest, err := expander.Expand(config)
 	if err != nil {
-		fmt.Printf("Error building DNS request using miekg: %v\n", err)
+		fmt.Printf("Error expanding placeholders: %v\n", err)
 		return
 	}
+	dnsRequest.Header.ID = id
+	dnsRequest.Header.IDStrategy = &models.IDStrategy{Mode: "constant"}
 
-	// Pack the dns.Msg to convert to byte slice
-	packedMsg, err := dnsMsg.Pack()
+	// Craft the packet: build and pack the dns.Msg (miekg/dns), write the labels and pointers,
+	// hold it to the size policy, then write the overrides, the TSIG and the patches
+	packedMsg, dnsMsg, patched, sizeReport, err := crafter.Craft(dnsRequest)
 	if err != nil {
-		fmt.Printf("Error packing message: %v\n", err)
+		fmt.Printf("Error crafting packet: %v\n", err)
 		return
 	}
 
-	// Now we can apply our manual override for the Z flag
-	err = crafter.ApplyManualOverride(packedMsg, dnsRequest.Header)
-	if err != nil {
-		fmt.Printf("Error applying manual overrides: %v\n", err)
+	// Visualize our packet to terminal, highlighting the patched bytes
+	visualizer.VisualizePatchedPacket(packedMsg, patched)
+
+	// Show how much of the TXT records' capacity the data takes up
+	visualizer.VisualizeTXTCapacity(dnsMsg)
+
+	// Show the final size against the limit, and what the size policy did about it
+	visualizer.VisualizeSize(sizeReport)
+
+	// A capture is written instead of sending, so it needs no resolver (nor a network)
+	if dnsRequest.Capture != nil {
+		writeCapture(packedMsg, dnsRequest)
 		return
 	}
 
-	// Visualize our packet to terminal
-	visualizer.VisualizePacket(packedMsg)
-
 	// Determine the final resolver to use based on the YAML config.
 	finalResolver, err := utils.DetermineResolver(dnsRequest.Resolver)
 	if err != nil {
@@ -46,6 +72,18 @@ func main() {
 		return
 	}
 
+	// Zone transfers go over TCP and span any number of messages, so they're handled separately
+	if network.IsTransfer(dnsMsg) {
+		transferZone(packedMsg, dnsMsg, dnsRequest.Transfer, finalResolver)
+		return
+	}
+
+	// Over TCP, any number of queries can share the connection
+	if finalResolver.Transport == "tcp" {
+		sendOverTCP(packedMsg, config, expander, ids, finalResolver)
+		return
+	}
+
 	// Send Packet and Receive Response
 	responseBytes, err := network.SendAndReceivePacket(packedMsg, finalResolver)
 	if err != nil {
@@ -53,11 +91,14 @@ func main() {
 		return
 	}
 
-	// Process and Display the Response
+	showResponse(responseBytes)
+}
 
+// showResponse prints a response, parsed and as raw bytes.
+func showResponse(responseBytes []byte) {
 	color.Green("\n--- DNS Server Response ---")
 	var responseMsg dns.Msg
-	err = responseMsg.Unpack(responseBytes)
+	err := responseMsg.Unpack(responseBytes)
 	if err != nil {
 		fmt.Printf("Error unpacking response packet: %v\n", err)
 		// Even if unpacking fails, visualize raw bytes
@@ -70,5 +111,119 @@ func main() {
 
 	// And visualize the raw response packet.
 	visualizer.VisualizePacket(responseBytes)
+}
+
+// sendOverTCP sends the message over TCP, along with the rest of the pipeline if the config asks for one,
+// and shows every response that comes back.
+func sendOverTCP(packedMsg []byte, config models.DNSRequest, expander *crafter.Expander, ids *crafter.IDSequence, resolver models.Resolver) {
+	packets := [][]byte{packedMsg}
+	if resolver.TCP != nil && resolver.TCP.Pipeline > 1 {
+		more, err := pipelinedQueries(config, expander, ids, resolver.TCP.Pipeline-1)
+		if err != nil {
+			fmt.Printf("Error crafting pipelined queries: %v\n", err)
+			return
+		}
+		packets = append(packets, more...)
+	}
+
+	responses, err := network.SendAndReceiveTCP(packets, resolver)
+	for _, responseBytes := range responses {
+		showResponse(responseBytes)
+	}
+	if err != nil {
+		fmt.Printf("\nError during network communication: %v\n", err)
+	}
+}
+
+// pipelinedQueries crafts the queries that follow the first one in a pipeline, each with the
+// next ID of the ID strategy (ids carries on from the first query) and its placeholders
+// expanded again, like cmd/encode's series.
+func pipelinedQueries(config models.DNSRequest, expander *crafter.Expander, ids *crafter.IDSequence, n int) ([][]byte, error) {
+	var packets [][]byte
+	for i := range n {
+		req, err := expander.Expand(config)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.ID = ids.Next()
+		req.Header.IDStrategy = &models.IDStrategy{Mode: "constant"}
 
+		packet, _, _, _, err := crafter.Craft(req)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("\n📨 Pipelined query %d: %d bytes, ID %d\n", i+2, len(packet), req.Header.ID)
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+// writeCapture writes the message to a synthetic capture, preceded by the query it answers if the config asks for it.
+func writeCapture(packedMsg []byte, dnsRequest models.DNSRequest) {
+	cfg := *dnsRequest.Capture
+
+	msgs := [][]byte{packedMsg}
+	if cfg.IncludeQuery {
+		// The query takes the ID the response actually carries
+		query := crafter.MatchingQuery(dnsRequest, binary.BigEndian.Uint16(packedMsg[0:2]))
+		queryMsg, _, _, _, err := crafter.Craft(query)
+		if err != nil {
+			fmt.Printf("Error crafting matching query: %v\n", err)
+			return
+		}
+		msgs = [][]byte{queryMsg, packedMsg}
+	}
+
+	packets, err := capture.Exchange(cfg, dnsRequest.Resolver, msgs...)
+	if err != nil {
+		fmt.Printf("Error laying out capture: %v\n", err)
+		return
+	}
+
+	output, format := capture.Output(cfg)
+	if err := capture.Write(output, format, cfg.Append, packets); err != nil {
+		fmt.Printf("Error writing capture: %v\n", err)
+		return
+	}
+
+	for _, p := range packets {
+		fmt.Printf("\n📦 %s  %s:%d → %s:%d  %d bytes", p.Time.Format(time.RFC3339Nano), p.Src.IP, p.Src.Port, p.Dst.IP, p.Dst.Port, len(p.Payload))
+	}
+	fmt.Printf("\n💾 Wrote %d packet(s) to %s (%s)\n", len(packets), output, format)
+}
+
+// transferZone performs the AXFR or IXFR the message asks for, and writes the received zone to a file.
+func transferZone(packedMsg []byte, dnsMsg *dns.Msg, transfer *models.Transfer, resolver models.Resolver) {
+	output := defaultTransferOutput
+	timeout := defaultTransferTimeout
+	if transfer != nil {
+		if transfer.Output != "" {
+			output = transfer.Output
+		}
+		if transfer.Timeout > 0 {
+			timeout = time.Duration(transfer.Timeout) * time.Second
+		}
+	}
+
+	msgs, records, err := network.TransferZone(packedMsg, dnsMsg, resolver, timeout)
+	if err != nil {
+		fmt.Printf("\nError during zone transfer: %v\n", err)
+		// Even if the transfer failed, show the last message we received
+		if len(msgs) > 0 {
+			fmt.Println(msgs[len(msgs)-1].String())
+		}
+		return
+	}
+
+	color.Green("\n--- Zone Transfer ---")
+	for _, rr := range records {
+		fmt.Println(rr.String())
+	}
+
+	zone := dnsMsg.Question[0].Name
+	if err := network.WriteZoneFile(output, zone, dnsMsg.Question[0].Qtype, records); err != nil {
+		fmt.Printf("Error writing zone: %v\n", err)
+		return
+	}
+	fmt.Printf("\n💾 Wrote %d record(s) of %s to %s\n", len(records), zone, output)
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stateSuffix is added to the path of the agent's binary to get the file it keeps its send count in
+const stateSuffix = ".state"
+
+// resumeSendCount has the expander carry on from the send count of the last run, so {{counter}},
+// {{seq_chunk}} and the ID strategy keep advancing from one run to the next, and returns the
+// function that saves the new count once the agent is done. A state file that can't be read
+// means starting over at 0.
+func resumeSendCount(expander *crafter.Expander) func() {
+	path, err := statePath()
+	if err != nil {
+		fmt.Printf("Warning: the send count won't carry over to the next run: %v\n", err)
+		return func() {}
+	}
+
+	count, err := loadSendCount(path)
+	if err != nil {
+		fmt.Printf("Warning: starting the send count over at 0: %v\n", err)
+	}
+	expander.SetSent(count)
+
+	return func() {
+		if err := saveSendCount(path, expander.Sent()); err != nil {
+			fmt.Printf("Warning: the send count won't carry over to the next run: %v\n", err)
+		}
+	}
+}
+
+// statePath returns the file the agent keeps its send count in, next to its own binary.
+// Every copy of the agent keeps a count of its own, and deleting the file starts over.
+func statePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the agent's binary: %w", err)
+	}
+	return exe + stateSuffix, nil
+}
+
+// loadSendCount returns the number of messages earlier runs sent, 0 if there's no state file yet.
+func loadSendCount(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("'%s' doesn't hold a valid send count: %q", path, strings.TrimSpace(string(data)))
+	}
+	return count, nil
+}
+
+// saveSendCount writes the number of messages sent so far to the state file.
+func saveSendCount(path string, count int) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(count)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"github.com/faanross/spinnekop/internal/analyzer"
 	"github.com/faanross/spinnekop/internal/models"
 	"github.com/miekg/dns"
 	"github.com/nsf/termbox-go"
 	"os"
+	"time"
 )
 
 func (app *App) run() {
@@ -93,6 +95,12 @@ func (app *App) renderDetail() {
 	//printLine(0, y, fmt.Sprintf("   Type: %s | Size: %d bytes", app.current.Type, len(app.current.RawData)), termbox.ColorWhite)
 	y += 2
 
+	// Parse error, in which case everything below is only what miekg managed to unpack
+	if app.current.ParseError != "" {
+		printLine(0, y, fmt.Sprintf("⚠️  PARSE ERROR: %s", app.current.ParseError), termbox.ColorRed|termbox.AttrBold)
+		y += 2
+	}
+
 	// Header Section
 	printLine(0, y, "🏷️DNS HEADER", termbox.ColorWhite|termbox.AttrBold)
 	y++
@@ -139,6 +147,14 @@ func (app *App) renderDetail() {
 		printLine(0, y, fmt.Sprintf("➕ ADDITIONAL SECTION (%d records)", len(msg.Extra)), termbox.ColorWhite|termbox.AttrBold)
 		y++
 		y = app.renderResourceRecords(msg.Extra, y)
+		y++
+	}
+
+	// TSIG Section
+	if tsig := msg.IsTsig(); tsig != nil {
+		printLine(0, y, "🔏 TSIG", termbox.ColorWhite|termbox.AttrBold)
+		y++
+		y = app.renderTSIG(tsig, y)
 	}
 
 	// Instructions at bottom
@@ -164,8 +180,17 @@ func (app *App) renderHeader(msg *dns.Msg, y int) int {
 	y++
 
 	// Opcode
-	printLine(2, y, fmt.Sprintf("├ Opcode: %d (%s) ", msg.Opcode, dns.OpcodeToString[msg.Opcode]), termbox.ColorWhite)
+	opcodeStr, ok := dns.OpcodeToString[msg.Opcode]
+	if !ok {
+		opcodeStr = "Reserved"
+	}
+	printLine(2, y, fmt.Sprintf("├ Opcode: %d (%s) ", msg.Opcode, opcodeStr), termbox.ColorWhite)
 	y++
+	// Add warning if it's one of the reserved opcodes
+	if !ok {
+		printLine(2, y, "├ ⚠️  WARNING: Reserved opcode detected!      ", termbox.ColorRed|termbox.AttrBold)
+		y++
+	}
 
 	// AA Flag
 	printLine(2, y, fmt.Sprintf("├ AA: %d (Authoritative Answer: %s) ", boolToInt(msg.Authoritative), boolToString(msg.Authoritative)), termbox.ColorWhite)
@@ -183,7 +208,13 @@ func (app *App) renderHeader(msg *dns.Msg, y int) int {
 	printLine(2, y, fmt.Sprintf("├ RA: %d (Recursion Available: %s) ", boolToInt(msg.RecursionAvailable), boolToString(msg.RecursionAvailable)), termbox.ColorWhite)
 	y++
 
-	// Z Flag
+	// AD and CD Flags, these used to be part of Z but are normal in DNSSEC traffic
+	printLine(2, y, fmt.Sprintf("├ AD: %d (Authenticated Data: %s) ", boolToInt(msg.AuthenticatedData), boolToString(msg.AuthenticatedData)), termbox.ColorWhite)
+	y++
+	printLine(2, y, fmt.Sprintf("├ CD: %d (Checking Disabled: %s) ", boolToInt(msg.CheckingDisabled), boolToString(msg.CheckingDisabled)), termbox.ColorWhite)
+	y++
+
+	// Z Flag, only the one bit that's still reserved
 	printLine(2, y, fmt.Sprintf("├ Z: %d (Reserved - should be 0)", app.current.ZValue), termbox.ColorWhite)
 	y++
 	// Add warning if non-zero
@@ -211,6 +242,18 @@ func (app *App) renderHeader(msg *dns.Msg, y int) int {
 	printLine(2, y, fmt.Sprintf("├ Additional: %d", len(msg.Extra)), termbox.ColorWhite)
 	y++
 
+	// Add a warning for every header count that doesn't match the sections present
+	for _, mismatch := range app.current.CountMismatches {
+		printLine(2, y, fmt.Sprintf("├ ⚠️  WARNING: Count mismatch: %s", mismatch), termbox.ColorRed|termbox.AttrBold)
+		y++
+	}
+
+	// And for every compression pointer a well-behaved server would never write
+	for _, anomaly := range app.current.PointerAnomalies {
+		printLine(2, y, fmt.Sprintf("├ ⚠️  WARNING: Malicious pointer: %s", anomaly), termbox.ColorRed|termbox.AttrBold)
+		y++
+	}
+
 	printLine(2, y, "└──────────────────", termbox.ColorWhite)
 	y++
 
@@ -218,12 +261,23 @@ func (app *App) renderHeader(msg *dns.Msg, y int) int {
 }
 
 func (app *App) renderQuestions(questions []dns.Question, y int) int {
+	// Most resolvers only support a single question, so flag anything else
+	if len(questions) > 1 {
+		printLine(2, y, fmt.Sprintf("⚠️  WARNING: Multiple questions detected (QDCOUNT=%d)!", len(questions)), termbox.ColorRed|termbox.AttrBold)
+		y++
+	}
+
 	for i, q := range questions {
 		printLine(2, y, fmt.Sprintf("%d. Name: %s", i+1, q.Name), termbox.ColorWhite)
 		y++
-		printLine(4, y, fmt.Sprintf("Type: %s (%d)", dns.TypeToString[q.Qtype], q.Qtype), termbox.ColorWhite)
+		// Type.String() and Class.String() fall back to the generic "TYPEnnn" and "CLASSnnn" forms
+		printLine(4, y, fmt.Sprintf("Type: %s (%d)", dns.Type(q.Qtype).String(), q.Qtype), termbox.ColorWhite)
 		y++
-		printLine(4, y, fmt.Sprintf("Class: %s (%d)", dns.ClassToString[q.Qclass], q.Qclass), termbox.ColorWhite)
+		if _, ok := dns.TypeToString[q.Qtype]; !ok {
+			printLine(4, y, "⚠️  WARNING: Unknown type detected!", termbox.ColorRed|termbox.AttrBold)
+			y++
+		}
+		printLine(4, y, fmt.Sprintf("Class: %s (%d)", dns.Class(q.Qclass).String(), q.Qclass), termbox.ColorWhite)
 		y++
 		if q.Qclass != dns.ClassINET {
 			printLine(4, y, "⚠️  WARNING: Non-IN class detected!", termbox.ColorRed|termbox.AttrBold)
@@ -237,6 +291,11 @@ func (app *App) renderResourceRecords(records []dns.RR, y int) int {
 	for i, rr := range records {
 		// Format the record more nicely
 		rrStr := rr.String()
+
+		// TSIG has no presentation format (miekg prints a pseudosection), it has its own section
+		if tsig, ok := rr.(*dns.TSIG); ok {
+			rrStr = fmt.Sprintf("%s\tTSIG\t%s (see TSIG section)", tsig.Hdr.Name, tsig.Algorithm)
+		}
 		if len(rrStr) > 75 {
 			rrStr = rrStr[:72] + "..."
 		}
@@ -246,6 +305,54 @@ func (app *App) renderResourceRecords(records []dns.RR, y int) int {
 	return y
 }
 
+func (app *App) renderTSIG(tsig *dns.TSIG, y int) int {
+	printLine(2, y, fmt.Sprintf("├ Key Name:    %s", tsig.Hdr.Name), termbox.ColorWhite)
+	y++
+	printLine(2, y, fmt.Sprintf("├ Algorithm:   %s", tsig.Algorithm), termbox.ColorWhite)
+	y++
+	signed := time.Unix(int64(tsig.TimeSigned), 0).UTC()
+	printLine(2, y, fmt.Sprintf("├ Time Signed: %d (%s), Fudge: %ds", tsig.TimeSigned, signed.Format(time.RFC3339), tsig.Fudge), termbox.ColorWhite)
+	y++
+	mac := tsig.MAC
+	if len(mac) > 64 {
+		mac = mac[:61] + "..."
+	}
+	printLine(2, y, fmt.Sprintf("├ MAC (%d bytes): %s", tsig.MACSize, mac), termbox.ColorWhite)
+	y++
+	printLine(2, y, fmt.Sprintf("├ Original ID: %d | Error: %d (%s)", tsig.OrigId, tsig.Error, dns.RcodeToString[int(tsig.Error)]), termbox.ColorWhite)
+	y++
+
+	if app.tsigKey == nil {
+		printLine(2, y, "└ Not verified, provide the key with the -tsig-key flag", termbox.ColorYellow)
+		return y + 1
+	}
+
+	err := analyzer.VerifyTSIG(app.current.RawData, tsig, *app.tsigKey, app.requestMAC())
+	if err != nil {
+		printLine(2, y, fmt.Sprintf("└ ⚠️  INVALID: %v", err), termbox.ColorRed|termbox.AttrBold)
+		return y + 1
+	}
+	printLine(2, y, fmt.Sprintf("└ ✅ Valid, signed with key %s", app.tsigKey.Name), termbox.ColorGreen|termbox.AttrBold)
+	return y + 1
+}
+
+// requestMAC returns the MAC of the signed request the current packet responds to, if any.
+// A response to a signed request is signed over the request's MAC as well.
+func (app *App) requestMAC() string {
+	if !app.current.Msg.Response {
+		return ""
+	}
+	for _, p := range app.packets {
+		if p.Msg == nil || p.Msg.Response || p.Msg.Id != app.current.Msg.Id {
+			continue
+		}
+		if tsig := p.Msg.IsTsig(); tsig != nil {
+			return tsig.MAC
+		}
+	}
+	return ""
+}
+
 func (app *App) handleListInput(ev termbox.Event) {
 	switch ev.Key {
 	case termbox.KeyArrowUp:
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"github.com/faanross/spinnekop/internal/analyzer"
 	"github.com/faanross/spinnekop/internal/models"
 	"github.com/faanross/spinnekop/internal/pcap"
 	"github.com/nsf/termbox-go"
@@ -21,12 +22,14 @@ type App struct {
 	offset   int
 	state    AppState
 	current  *models.DNSPacket
+	tsigKey  *analyzer.TSIGKey // Key to verify TSIG records with, if given
 }
 
 func main() {
 	// read pcap from disk (provided by -pcap flag)
 	var pcapFile string
 	flag.StringVar(&pcapFile, "pcap", "", "Path to pcap file")
+	tsigKeyFlag := flag.String("tsig-key", "", "TSIG key to verify signed messages with, as [algorithm:]name:secret")
 	flag.Parse()
 
 	if pcapFile == "" {
@@ -43,11 +46,22 @@ func main() {
 		log.Fatal("No DNS packets found in pcap")
 	}
 
+	// Parse the TSIG key, if given
+	var tsigKey *analyzer.TSIGKey
+	if *tsigKeyFlag != "" {
+		key, err := analyzer.ParseTSIGKey(*tsigKeyFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tsigKey = &key
+	}
+
 	// Set up our  UI state struct
 
 	app := &App{
 		packets: packets,
 		state:   StateList,
+		tsigKey: tsigKey,
 	}
 
 	err = termbox.Init()
@@ -21,7 +21,7 @@ import (
 
 const (
 	// Paths relative to the project root
-	yamlConfigSourcePath   = "./configs/response.yaml" // Agent's YAML config
+	yamlConfigSourcePath   = "./configs/response.yaml" // Agent's default YAML config
 	embeddedGoConfigTarget = "./cmd/agent/config.go"   // Output path for generated Go config
 	agentMainPackagePath   = "./cmd/agent"             // Path to agent's main package for compilation
 	defaultOutputDir       = "./bin"                   // Default output directory for binaries
@@ -33,10 +33,11 @@ func main() {
 
 	// NOTE: If no flag is provided will compile for host OS + ARCH
 	target := flag.String("target", "current", "Build target: current, windows-amd64, linux-amd64, darwin-amd64, darwin-arm64, all")
+	configPath := flag.String("config", yamlConfigSourcePath, "YAML config to embed, e.g. configs/notify.yaml or configs/transfer.yaml")
 	flag.Parse()
 
-	// Generate  config.go file from yamlConfigSourcePath
-	if err := generateEmbeddedConfig(); err != nil {
+	// Generate  config.go file from the config
+	if err := generateEmbeddedConfig(*configPath); err != nil {
 		log.Fatalf("Build Error: Failed to generate embedded config: %v", err)
 	}
 
@@ -100,20 +101,25 @@ func main() {
 }
 
 // generateEmbeddedConfig reads the YAML then writes the cmd/agent/config.go file for static compilation
-func generateEmbeddedConfig() error {
+func generateEmbeddedConfig(configPath string) error {
 
-	// Read YAML file from disk - as specified in yamlConfigSourcePath
-	log.Printf("Build: Reading YAML config from '%s'", yamlConfigSourcePath)
-	yamlFile, err := os.ReadFile(yamlConfigSourcePath)
+	// Read YAML file from disk - as specified by the -config flag
+	log.Printf("Build: Reading YAML config from '%s'", configPath)
+	yamlFile, err := os.ReadFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read YAML config file '%s': %w", yamlConfigSourcePath, err)
+		return fmt.Errorf("failed to read YAML config file '%s': %w", configPath, err)
 	}
 
 	// Instantiate DNSRequest struct and unmarshall YAML contents into it
 	var cfgFromYAML models.DNSRequest
 	err = yaml.Unmarshal(yamlFile, &cfgFromYAML)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal YAML from '%s': %w", yamlConfigSourcePath, err)
+		return fmt.Errorf("failed to unmarshal YAML from '%s': %w", configPath, err)
+	}
+
+	// Configs from when z held all 3 reserved bits still build, with the bits moved to their new fields
+	if warning := cfgFromYAML.Header.MigrateLegacyZ(); warning != "" {
+		log.Printf("Build Warning: %s", warning)
 	}
 
 	// Validate configuration values at compile time
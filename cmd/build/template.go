@@ -8,52 +8,292 @@ const configGoTemplate = `// Code generated by cmd/build/main.go; DO NOT EDIT.
     )
     
     var embeddedAgentConfig = models.DNSRequest{
-		Header:   Header,
-		Question: Question,
-		Resolver: Resolver,
-		Answers:  Answers,
+		Header:      Header,
+		Question:    Question,
+		Questions:   Questions,
+		Resolver:    Resolver,
+		Answers:     Answers,
+		Authority:   Authority,
+		Additional:  Additional,
+		Update:      Update,
+		Transfer:    Transfer,
+		Capture:     Capture,
+		EDNS:        EDNS,
+		Compression: Compression,
+		AllowViolations: {{.AllowViolations}},
+		DNSSEC:          DNSSEC,
+		TSIG:            TSIG,
+		Size:            Size,
+		Patches:         Patches,
 	}
 
 	var Header = models.Header{
 		ID:                          {{.Header.ID}},
+		IDStrategy: {{with .Header.IDStrategy}}&models.IDStrategy{
+			Mode:  {{printf "%q" .Mode}},
+			Seed:  {{with .Seed}}int64Ptr({{.}}){{else}}nil{{end}},
+			Start: {{.Start}},
+			Step:  {{.Step}},
+			List:  []uint16{ {{range .List}}{{.}}, {{end}} },
+		}{{else}}nil{{end}},
 		QR:                          {{.Header.QR}},
-		OpCode:                      "{{.Header.OpCode}}",
+		OpCode:                      {{printf "%q" .Header.OpCode}},
+		StdOpCode:                   {{.Header.StdOpCode}},
+		CustomOpCode:                {{.Header.CustomOpCode}},
 		Authoritative:               {{.Header.Authoritative}},
 		Truncated:                   {{.Header.Truncated}},
 		RecursionDesired:            {{.Header.RecursionDesired}},
 		RecursionAvailable:          {{.Header.RecursionAvailable}},
+		AuthenticatedData:           {{.Header.AuthenticatedData}},
+		CheckingDisabled:            {{.Header.CheckingDisabled}},
 		Z:                           {{.Header.Z}},
 		RCode:                       {{.Header.RCode}},
+		CountOverrides: {{with .Header.CountOverrides}}&models.CountOverrides{
+			QDCount: {{with .QDCount}}uint16Ptr({{.}}){{else}}nil{{end}},
+			ANCount: {{with .ANCount}}uint16Ptr({{.}}){{else}}nil{{end}},
+			NSCount: {{with .NSCount}}uint16Ptr({{.}}){{else}}nil{{end}},
+			ARCount: {{with .ARCount}}uint16Ptr({{.}}){{else}}nil{{end}},
+		}{{else}}nil{{end}},
 	}
 
-	var Question = models.Question{
-		Name:                        "{{.Question.Name}}",
-		Type:                        "{{.Question.Type}}",
-		Class:                       "{{.Question.Class}}",
-		StdClass:                    {{.Question.StdClass}},
-		CustomClass:                 {{.Question.CustomClass}},
+	var Question = models.Question{{template "question" .Question}}
+
+	var Questions = []models.Question{
+		{{if .Questions}}{{range .Questions}}{{template "question" .}},
+		{{end}}{{end}}
 	}
 
 	var Resolver = models.Resolver{
 		UseSystemDefaults:           {{.Resolver.UseSystemDefaults}},
-		IP:                          "{{.Resolver.IP}}",
+		IP:                          {{printf "%q" .Resolver.IP}},
 		Port:                        {{.Resolver.Port}},
+		Transport:                   {{printf "%q" .Resolver.Transport}},
+		TCP: {{with .Resolver.TCP}}&models.TCPOptions{
+			LengthPrefix: {{with .LengthPrefix}}uint16Ptr({{.}}){{else}}nil{{end}},
+			LengthDelta:  {{.LengthDelta}},
+			Segments:     []int{ {{range .Segments}}{{.}}, {{end}} },
+			SegmentDelay: {{.SegmentDelay}},
+			Pipeline:     {{.Pipeline}},
+		}{{else}}nil{{end}},
 	}
 
 	var Answers = []models.Answer{
-		{{if .Answers}}{{range .Answers}}{
-			Name:  "{{.Name}}",
-			Type:  "{{.Type}}",
-			Class: "{{.Class}}",
-			TTL:   {{.TTL}},
-			Data:  "{{.Data}}",
-		},
+		{{if .Answers}}{{range .Answers}}{{template "record" .}}
 		{{end}}{{end}}
 	}
 
+	var Authority = []models.Answer{
+		{{if .Authority}}{{range .Authority}}{{template "record" .}}
+		{{end}}{{end}}
+	}
+
+	var Additional = []models.Answer{
+		{{if .Additional}}{{range .Additional}}{{template "record" .}}
+		{{end}}{{end}}
+	}
+
+	var EDNS = {{with .EDNS}}&models.EDNS{
+		UDPSize:       {{.UDPSize}},
+		Version:       {{.Version}},
+		DO:            {{.DO}},
+		Z:             {{.Z}},
+		ExtendedRCode: {{.ExtendedRCode}},
+		Options: []models.EDNSOption{
+			{{range .Options}}{
+				Type:          {{printf "%q" .Type}},
+				Code:          {{.Code}},
+				Data:          {{printf "%q" .Data}},
+				Family:        {{.Family}},
+				SourceNetmask: {{.SourceNetmask}},
+				SourceScope:   {{.SourceScope}},
+				Address:       {{printf "%q" .Address}},
+				Cookie:        {{printf "%q" .Cookie}},
+				Length:        {{.Length}},
+			},
+			{{end}}
+		},
+	}{{else}}(*models.EDNS)(nil){{end}}
+
+	var Transfer = {{with .Transfer}}&models.Transfer{
+		Output:  {{printf "%q" .Output}},
+		Timeout: {{.Timeout}},
+	}{{else}}(*models.Transfer)(nil){{end}}
+
+	var Size = {{with .Size}}&models.SizePolicy{
+		Policy: {{printf "%q" .Policy}},
+		Limit:  {{.Limit}},
+	}{{else}}(*models.SizePolicy)(nil){{end}}
+
+	var Capture = {{with .Capture}}&models.Capture{
+		Output:        {{printf "%q" .Output}},
+		Format:        {{printf "%q" .Format}},
+		Append:        {{.Append}},
+		ClientIP:      {{printf "%q" .ClientIP}},
+		ServerIP:      {{printf "%q" .ServerIP}},
+		ClientPort:    {{.ClientPort}},
+		ServerPort:    {{.ServerPort}},
+		ClientMAC:     {{printf "%q" .ClientMAC}},
+		ServerMAC:     {{printf "%q" .ServerMAC}},
+		Timestamp:     {{printf "%q" .Timestamp}},
+		IncludeQuery:  {{.IncludeQuery}},
+		ResponseDelay: {{.ResponseDelay}},
+	}{{else}}(*models.Capture)(nil){{end}}
+
+	var Update = {{with .Update}}&models.Update{
+		Zone:  {{printf "%q" .Zone}},
+		Class: {{printf "%q" .Class}},
+		Prerequisites: []models.UpdatePrerequisite{
+			{{range .Prerequisites}}{
+				Condition: {{printf "%q" .Condition}},
+				Name:      {{printf "%q" .Name}},
+				Type:      {{printf "%q" .Type}},
+				Data:      {{printf "%q" .Data}},
+				{{- with .RData}}
+				RData: {{template "rdata" .}},
+				{{- end}}
+			},
+			{{end}}
+		},
+		Operations: []models.UpdateOperation{
+			{{range .Operations}}{
+				Action: {{printf "%q" .Action}},
+				Name:   {{printf "%q" .Name}},
+				Type:   {{printf "%q" .Type}},
+				TTL:    {{.TTL}},
+				Data:   {{printf "%q" .Data}},
+				{{- with .RData}}
+				RData: {{template "rdata" .}},
+				{{- end}}
+			},
+			{{end}}
+		},
+	}{{else}}(*models.Update)(nil){{end}}
+
+	var Compression = {{with .Compression}}&models.Compression{
+		Mode: {{printf "%q" .Mode}},
+		Pointers: []models.PointerInjection{
+			{{range .Pointers}}{
+				Name:       {{printf "%q" .Name}},
+				KeepLabels: {{.KeepLabels}},
+				Kind:       {{printf "%q" .Kind}},
+				Target:     {{printf "%q" .Target}},
+				Offset:     {{.Offset}},
+			},
+			{{end}}
+		},
+	}{{else}}(*models.Compression)(nil){{end}}
+
+	var DNSSEC = {{with .DNSSEC}}&models.DNSSEC{
+		Zone:            {{printf "%q" .Zone}},
+		KeyFile:         {{printf "%q" .KeyFile}},
+		Algorithm:       {{printf "%q" .Algorithm}},
+		Signatures:      {{printf "%q" .Signatures}},
+		Validity:        {{.Validity}},
+		DNSKEY:          {{.DNSKEY}},
+		DS:              {{.DS}},
+		Denial:          {{printf "%q" .Denial}},
+		NextName:        {{printf "%q" .NextName}},
+		NSEC3Iterations: {{.NSEC3Iterations}},
+		NSEC3Salt:       {{printf "%q" .NSEC3Salt}},
+	}{{else}}(*models.DNSSEC)(nil){{end}}
+
+	var TSIG = {{with .TSIG}}&models.TSIG{
+		KeyName:      {{printf "%q" .KeyName}},
+		Algorithm:    {{printf "%q" .Algorithm}},
+		Secret:       {{printf "%q" .Secret}},
+		Fudge:        {{.Fudge}},
+		TimeSigned:   {{.TimeSigned}},
+		TimeSkew:     {{.TimeSkew}},
+		RequestMAC:   {{printf "%q" .RequestMAC}},
+		BadMAC:       {{.BadMAC}},
+		WrongKeyName: {{printf "%q" .WrongKeyName}},
+	}{{else}}(*models.TSIG)(nil){{end}}
+
+	var Patches = []models.Patch{
+		{{range .Patches}}{
+			Anchor: {{printf "%q" .Anchor}},
+			Offset: {{with .Offset}}uint16Ptr({{.}}){{else}}nil{{end}},
+			Bytes:  {{printf "%q" .Bytes}},
+			Mask:   {{printf "%q" .Mask}},
+			Value:  {{printf "%q" .Value}},
+			Append: {{printf "%q" .Append}},
+		},
+		{{end}}
+	}
+
     // getEmbeddedAgentConfig is called by the agent's main.go to retrieve this configuration.
     func getEmbeddedAgentConfig() models.DNSRequest {
     	return embeddedAgentConfig
     }
 
+    // uint16Ptr is used for optional fields, where 0 is a meaningful value.
+    func uint16Ptr(v uint16) *uint16 {
+    	return &v
+    }
+
+    // int64Ptr is used for optional fields, where 0 is a meaningful value.
+    func int64Ptr(v int64) *int64 {
+    	return &v
+    }
+{{define "question"}}{
+		Name:                        {{printf "%q" .Name}},
+		Type:                        {{printf "%q" .Type}},
+		StdType:                     {{.StdType}},
+		CustomType:                  {{.CustomType}},
+		Class:                       {{printf "%q" .Class}},
+		StdClass:                    {{.StdClass}},
+		CustomClass:                 {{.CustomClass}},
+		{{- if .Labels}}
+		Labels:                      {{template "labels" .Labels}},
+		{{- end}}
+	}{{end}}
+{{define "record"}}{
+			Name:  {{printf "%q" .Name}},
+			Type:  {{printf "%q" .Type}},
+			Class: {{printf "%q" .Class}},
+			StdClass: {{.StdClass}},
+			CustomClass: {{.CustomClass}},
+			CacheFlush: {{.CacheFlush}},
+			TTL:   {{.TTL}},
+			Data:  {{printf "%q" .Data}},
+			{{- with .TXT}}
+			TXT: &models.TXTOptions{
+				ChunkSize:  {{.ChunkSize}},
+				MaxStrings: {{.MaxStrings}},
+				Records:    {{.Records}},
+			},
+			{{- end}}
+			TypeCode: {{.TypeCode}},
+			RawRData: {{printf "%q" .RawRData}},
+			{{- if .Labels}}
+			Labels: {{template "labels" .Labels}},
+			{{- end}}
+			{{- with .RData}}
+			RData: {{template "rdata" .}},
+			{{- end}}
+		},{{end}}
+{{define "rdata"}}&models.RData{
+				Address:    {{printf "%q" .Address}},
+				Target:     {{printf "%q" .Target}},
+				Preference: {{.Preference}},
+				Priority:   {{.Priority}},
+				Weight:     {{.Weight}},
+				Port:       {{.Port}},
+				MName:      {{printf "%q" .MName}},
+				RName:      {{printf "%q" .RName}},
+				Serial:     {{.Serial}},
+				Refresh:    {{.Refresh}},
+				Retry:      {{.Retry}},
+				Expire:     {{.Expire}},
+				Minimum:    {{.Minimum}},
+				Flag:       {{.Flag}},
+				Tag:        {{printf "%q" .Tag}},
+				Value:      {{printf "%q" .Value}},
+				Hex:        {{printf "%q" .Hex}},
+				Params:     {{printf "%q" .Params}},
+			}{{end}}
+{{define "labels"}}[]models.Label{
+			{{range .}}{Text: {{printf "%q" .Text}}, Hex: {{printf "%q" .Hex}}},
+			{{end}}
+		}{{end}}
 `
@@ -0,0 +1,161 @@
+// cmd/encode/main.go turns a payload (a file or a string) into a series of request/response
+// configs carrying it, along with a manifest. Each config can then be sent with the agent,
+// to test whether the analyzer and our sensors pick up on the encoded data.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/validate"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Paths relative to the project root
+	defaultQueryTemplate    = "./configs/request.yaml"  // Template for subdomain placement (queries)
+	defaultResponseTemplate = "./configs/response.yaml" // Template for txt and null placement (responses)
+	defaultOutputDir        = "./payload"               // Default output directory for configs and manifest
+	manifestFileName        = "manifest.yaml"
+)
+
+func main() {
+	log.Println("🕷️🕷️🕷️ Starting Spinnekop Payload Encoder 🕷️🕷️🕷️")
+
+	var options models.PayloadOptions
+	inFile := flag.String("in", "", "Path to the file to encode")
+	data := flag.String("data", "", "String to encode, used instead of -in")
+	outDir := flag.String("out", defaultOutputDir, "Output directory for the configs and manifest")
+	templatePath := flag.String("template", "", "Config to base every message on (default configs/request.yaml for subdomain, configs/response.yaml otherwise)")
+	verify := flag.String("verify", "", "Path to a manifest to reassemble and verify, instead of encoding")
+	flag.StringVar(&options.Placement, "placement", "subdomain", "Where the payload goes: subdomain, txt or null")
+	flag.StringVar(&options.Encoding, "encoding", "base32", "Payload encoding: hex, base32, base64 or base64url")
+	flag.StringVar(&options.Domain, "domain", "timeserversync.com", "Domain the chunks are sent under")
+	flag.IntVar(&options.LabelSize, "label-size", 63, "subdomain: maximum characters per label (1 - 63)")
+	flag.IntVar(&options.ChunkSize, "chunk-size", 0, "Encoded characters per message (default: as many as fit in a name, or 255)")
+	flag.Parse()
+
+	if *verify != "" {
+		if err := verifyManifest(*verify); err != nil {
+			log.Fatalf("Verify Error: %v", err)
+		}
+		return
+	}
+
+	// Read the payload from the file or the -data flag
+	var payload []byte
+	switch {
+	case *inFile != "":
+		var err error
+		payload, err = os.ReadFile(*inFile)
+		if err != nil {
+			log.Fatalf("Encode Error: failed to read payload '%s': %v", *inFile, err)
+		}
+	case *data != "":
+		payload = []byte(*data)
+	default:
+		log.Fatal("Please provide a payload with the -in or -data flag")
+	}
+
+	if *templatePath == "" {
+		*templatePath = defaultQueryTemplate
+		if options.Placement != "subdomain" {
+			*templatePath = defaultResponseTemplate
+		}
+	}
+
+	template, err := readConfig(*templatePath)
+	if err != nil {
+		log.Fatalf("Encode Error: %v", err)
+	}
+
+	requests, manifest, err := crafter.EncodePayload(payload, template, options)
+	if err != nil {
+		log.Fatalf("Encode Error: %v", err)
+	}
+	log.Printf("Encode: %d byte payload split into %d message(s)", len(payload), len(requests))
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Encode Error: failed to create output directory '%s': %v", *outDir, err)
+	}
+
+	// Every message gets the next ID from the template's ID strategy, which is then
+	// fixed in its config, so the series is the same every time it's sent
+	ids := crafter.NewIDSequence(template.Header)
+
+	// Validate and write every message, just like cmd/build would validate it
+	for i := range requests {
+		requests[i].Header.ID = ids.Next()
+		requests[i].Header.IDStrategy = &models.IDStrategy{Mode: "constant"}
+
+		if err := validate.ValidateRequest(&requests[i]); err != nil {
+			log.Fatalf("Encode Error: message %d is invalid, %v", i, err)
+		}
+
+		fileName := fmt.Sprintf("message_%04d.yaml", i)
+		if err := writeYAML(filepath.Join(*outDir, fileName), requests[i]); err != nil {
+			log.Fatalf("Encode Error: %v", err)
+		}
+		manifest.Chunks[i].File = fileName
+	}
+
+	manifestPath := filepath.Join(*outDir, manifestFileName)
+	if err := writeYAML(manifestPath, manifest); err != nil {
+		log.Fatalf("Encode Error: %v", err)
+	}
+	log.Printf("Encode: Wrote %d config(s) and the manifest to '%s'", len(requests), *outDir)
+}
+
+// readConfig reads and parses a request/response config.
+func readConfig(path string) (models.DNSRequest, error) {
+	var config models.DNSRequest
+
+	yamlFile, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read YAML config file '%s': %w", path, err)
+	}
+	if err := yaml.Unmarshal(yamlFile, &config); err != nil {
+		return config, fmt.Errorf("failed to unmarshal YAML from '%s': %w", path, err)
+	}
+	if warning := config.Header.MigrateLegacyZ(); warning != "" {
+		log.Printf("Warning: '%s': %s", path, warning)
+	}
+	return config, nil
+}
+
+// writeYAML marshals v into the file at path.
+func writeYAML(path string, v any) error {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal '%s': %w", path, err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
+
+// verifyManifest reassembles the payload from a manifest and checks it against its hash.
+func verifyManifest(path string) error {
+	yamlFile, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest '%s': %w", path, err)
+	}
+
+	var manifest models.PayloadManifest
+	if err := yaml.Unmarshal(yamlFile, &manifest); err != nil {
+		return fmt.Errorf("failed to unmarshal manifest '%s': %w", path, err)
+	}
+
+	payload, err := crafter.ReassemblePayload(manifest)
+	if err != nil {
+		return err
+	}
+	log.Printf("Verify: Reassembled %d bytes from %d chunk(s), SHA256 %s matches", len(payload), len(manifest.Chunks), manifest.SHA256)
+	return nil
+}
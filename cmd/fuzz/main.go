@@ -0,0 +1,252 @@
+// cmd/fuzz/main.go mutates the packet crafted from a config and sends the mutants to a local
+// target, recording every packet that makes it time out, crash or send back garbage.
+// Each failing case is saved as a config (the template plus the mutations as patches)
+// and as raw hex, so it can be replayed with -replay, or built and sent with the agent.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/fuzz"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/validate"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Paths relative to the project root
+	defaultTemplate  = "./configs/request.yaml" // Config the packets are mutated from
+	defaultOutputDir = "./fuzz_cases"           // Default output directory for failing cases and the report
+	reportFileName   = "findings.yaml"
+
+	// progressInterval is how often (in iterations) we log how far along we are
+	progressInterval = 100
+)
+
+func main() {
+	log.Println("🕷️🕷️🕷️ Starting Spinnekop Fuzzer 🕷️🕷️🕷️")
+
+	templatePath := flag.String("template", defaultTemplate, "Config to craft the base packet from")
+	target := flag.String("target", "127.0.0.1:53", "Address (ip:port) of the DNS server to fuzz, over UDP")
+	iterations := flag.Int("iterations", 1000, "Number of mutated packets to send")
+	seed := flag.Int64("seed", 0, "Seed for the mutations, the same seed sends the same packets (default: from the clock)")
+	mutations := flag.String("mutations", "", "Comma separated mutations to use (default: all of "+strings.Join(fuzz.Kinds, ", ")+")")
+	maxMutations := flag.Int("max-mutations", 4, "Maximum number of mutations per packet")
+	timeout := flag.Duration("timeout", 2*time.Second, "How long to wait for a response")
+	outDir := flag.String("out", defaultOutputDir, "Output directory for failing cases and the report")
+	replay := flag.String("replay", "", "Path to a saved case to send again, instead of fuzzing")
+	flag.Parse()
+
+	t := fuzz.Target{Address: *target, Timeout: *timeout}
+
+	if *replay != "" {
+		if err := replayCase(*replay, t); err != nil {
+			log.Fatalf("Replay Error: %v", err)
+		}
+		return
+	}
+
+	if *iterations < 1 || *maxMutations < 1 {
+		log.Fatal("Fuzz Error: -iterations and -max-mutations must be at least 1")
+	}
+
+	template, err := readConfig(*templatePath)
+	if err != nil {
+		log.Fatalf("Fuzz Error: %v", err)
+	}
+
+	// Expand the placeholders and fix the ID, so a replayed case sends exactly the same packet
+	template, err = crafter.NewExpander().Expand(template)
+	if err != nil {
+		log.Fatalf("Fuzz Error: %v", err)
+	}
+	template.Header.ID = crafter.NewIDSequence(template.Header).Next()
+	template.Header.IDStrategy = &models.IDStrategy{Mode: "constant"}
+
+	if err := validate.ValidateRequest(&template); err != nil {
+		log.Fatalf("Fuzz Error: template is invalid, %v", err)
+	}
+
+	base, _, _, _, err := crafter.Craft(template)
+	if err != nil {
+		log.Fatalf("Fuzz Error: %v", err)
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	var kinds []string
+	if *mutations != "" {
+		kinds = strings.Split(*mutations, ",")
+	}
+	mutator, err := fuzz.NewMutator(*seed, kinds)
+	if err != nil {
+		log.Fatalf("Fuzz Error: %v", err)
+	}
+
+	// Without an answer to the unmutated packet, there's nothing to compare against
+	if !t.Alive(base) {
+		log.Fatalf("Fuzz Error: %s doesn't answer the unmutated packet, is it running?", *target)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Fuzz Error: failed to create output directory '%s': %v", *outDir, err)
+	}
+
+	log.Printf("Fuzz: Sending %d mutated packet(s) to %s, seed %d", *iterations, *target, *seed)
+
+	report := models.FuzzReport{
+		Template: *templatePath,
+		Target:   *target,
+		Seed:     *seed,
+		Outcomes: make(map[string]int),
+	}
+
+	for i := 0; i < *iterations; i++ {
+		packet, applied := mutator.Mutate(base, *maxMutations)
+		result := t.Run(packet, base)
+
+		report.Iterations++
+		report.Outcomes[string(result.Outcome)]++
+
+		if result.Outcome.Failing() {
+			finding, err := saveCase(*outDir, i, template, packet, applied, result)
+			if err != nil {
+				log.Fatalf("Fuzz Error: %v", err)
+			}
+			report.Findings = append(report.Findings, finding)
+			log.Printf("Fuzz: Case %d, %s: %v", i, result.Outcome, result.Err)
+		}
+
+		// Everything after a crash would be a crash as well
+		if result.Outcome == fuzz.OutcomeCrash {
+			log.Printf("Fuzz: %s stopped answering, stopping after %d packet(s)", *target, i+1)
+			break
+		}
+
+		if (i+1)%progressInterval == 0 {
+			log.Printf("Fuzz: %d/%d sent, %d failing case(s) so far", i+1, *iterations, len(report.Findings))
+		}
+	}
+
+	reportPath := filepath.Join(*outDir, reportFileName)
+	if err := writeYAML(reportPath, report); err != nil {
+		log.Fatalf("Fuzz Error: %v", err)
+	}
+	log.Printf("Fuzz: %d failing case(s) in %d packet(s), outcomes %v, report written to '%s'", len(report.Findings), report.Iterations, report.Outcomes, reportPath)
+}
+
+// saveCase writes a failing case as a config, with the mutations appended to the template's
+// patches, and as raw hex. It returns the finding for the report.
+func saveCase(outDir string, i int, template models.DNSRequest, packet []byte, applied []fuzz.Mutation, result fuzz.Result) (models.FuzzFinding, error) {
+	finding := models.FuzzFinding{
+		Case:    i,
+		Outcome: string(result.Outcome),
+		Config:  fmt.Sprintf("case_%06d.yaml", i),
+		Hex:     fmt.Sprintf("case_%06d.hex", i),
+	}
+	if result.Err != nil {
+		finding.Error = result.Err.Error()
+	}
+	if result.Outcome == fuzz.OutcomeParseFailure {
+		finding.Response = hex.EncodeToString(result.Response)
+	}
+
+	config := template
+	config.Patches = slices.Clone(template.Patches)
+	for _, mutation := range applied {
+		config.Patches = append(config.Patches, mutation.Patch)
+		finding.Mutations = append(finding.Mutations, mutation.Description)
+	}
+
+	if err := writeYAML(filepath.Join(outDir, finding.Config), config); err != nil {
+		return finding, err
+	}
+
+	hexPath := filepath.Join(outDir, finding.Hex)
+	if err := os.WriteFile(hexPath, []byte(hex.EncodeToString(packet)+"\n"), 0644); err != nil {
+		return finding, fmt.Errorf("failed to write '%s': %w", hexPath, err)
+	}
+
+	return finding, nil
+}
+
+// replayCase crafts the packet from a saved case, checks it against the hex saved
+// alongside it (if there is one), and sends it to the target again.
+func replayCase(path string, t fuzz.Target) error {
+	config, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := validate.ValidateRequest(&config); err != nil {
+		return fmt.Errorf("case is invalid, %w", err)
+	}
+
+	packet, _, _, _, err := crafter.Craft(config)
+	if err != nil {
+		return err
+	}
+
+	hexPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".hex"
+	if saved, err := os.ReadFile(hexPath); err == nil {
+		if strings.TrimSpace(string(saved)) != hex.EncodeToString(packet) {
+			log.Printf("Replay: Crafted packet doesn't match '%s', TSIG and DNSSEC signatures change every time they're made", hexPath)
+		} else {
+			log.Printf("Replay: Crafted packet matches '%s'", hexPath)
+		}
+	}
+
+	response, err := t.Send(packet)
+	if err != nil {
+		log.Printf("Replay: Sent %d bytes to %s, no response: %v", len(packet), t.Address, err)
+		return nil
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(response); err != nil {
+		log.Printf("Replay: Sent %d bytes to %s, failed to parse the %d byte response: %v", len(packet), t.Address, len(response), err)
+		log.Printf("Replay: Response %s", hex.EncodeToString(response))
+		return nil
+	}
+	log.Printf("Replay: Sent %d bytes to %s, got a %d byte response (%s)", len(packet), t.Address, len(response), dns.RcodeToString[msg.Rcode])
+	return nil
+}
+
+// readConfig reads and parses a request/response config.
+func readConfig(path string) (models.DNSRequest, error) {
+	var config models.DNSRequest
+
+	yamlFile, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read YAML config file '%s': %w", path, err)
+	}
+	if err := yaml.Unmarshal(yamlFile, &config); err != nil {
+		return config, fmt.Errorf("failed to unmarshal YAML from '%s': %w", path, err)
+	}
+	if warning := config.Header.MigrateLegacyZ(); warning != "" {
+		log.Printf("Warning: '%s': %s", path, warning)
+	}
+	return config, nil
+}
+
+// writeYAML marshals v into the file at path.
+func writeYAML(path string, v any) error {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal '%s': %w", path, err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
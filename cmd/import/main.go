@@ -0,0 +1,132 @@
+// cmd/import/main.go turns an existing DNS message (a hex string, a binary file or a frame
+// in a pcap) into a request/response config. The config can then be built into the agent
+// to replay the message, or used as a template for cmd/encode and cmd/fuzz.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/convert"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/pcap"
+	"github.com/faanross/spinnekop/internal/validate"
+	"gopkg.in/yaml.v3"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	log.Println("🕷️🕷️🕷️ Starting Spinnekop Packet Importer 🕷️🕷️🕷️")
+
+	hexString := flag.String("hex", "", "The DNS message as a hex string (spaces and colons are ignored)")
+	inFile := flag.String("in", "", "Path to a file holding the raw DNS message")
+	pcapFile := flag.String("pcap", "", "Path to a pcap, the message is taken from -frame")
+	frame := flag.Int("frame", 0, "Frame number in the pcap (starting at 1, like Wireshark)")
+	outFile := flag.String("out", "", "Path to write the config to (default: stdout)")
+	resolver := flag.String("resolver", "", "Resolver (ip:port) to put in the config (default: use the system's)")
+	flag.Parse()
+
+	raw, err := readMessage(*hexString, *inFile, *pcapFile, *frame)
+	if err != nil {
+		log.Fatalf("Import Error: %v", err)
+	}
+
+	config, notes, err := convert.FromWire(raw)
+	if err != nil {
+		log.Fatalf("Import Error: %v", err)
+	}
+	for _, note := range notes {
+		log.Printf("Import: ⚠️  %s", note)
+	}
+
+	if *resolver != "" {
+		config.Resolver, err = parseResolver(*resolver)
+		if err != nil {
+			log.Fatalf("Import Error: %v", err)
+		}
+	}
+
+	if err := validate.ValidateRequest(&config); err != nil {
+		log.Printf("Import: ⚠️  The config needs changes before it can be built, %v", err)
+	} else {
+		verifyCraft(config, raw)
+	}
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		log.Fatalf("Import Error: failed to marshal config: %v", err)
+	}
+
+	if *outFile == "" {
+		fmt.Print(string(out))
+		return
+	}
+	if err := os.WriteFile(*outFile, out, 0644); err != nil {
+		log.Fatalf("Import Error: failed to write '%s': %v", *outFile, err)
+	}
+	log.Printf("Import: Wrote the config for the %d byte message to '%s'", len(raw), *outFile)
+}
+
+// readMessage reads the raw message from whichever source was given.
+func readMessage(hexString, inFile, pcapFile string, frame int) ([]byte, error) {
+	switch {
+	case hexString != "":
+		cleaned := strings.NewReplacer(" ", "", ":", "", "\n", "", "\t", "").Replace(hexString)
+		raw, err := hex.DecodeString(cleaned)
+		if err != nil {
+			return nil, fmt.Errorf("-hex is not a valid hex string: %w", err)
+		}
+		return raw, nil
+
+	case inFile != "":
+		raw, err := os.ReadFile(inFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", inFile, err)
+		}
+		return raw, nil
+
+	case pcapFile != "":
+		return pcap.ExtractFrame(pcapFile, frame)
+	}
+
+	return nil, fmt.Errorf("please provide a message with the -hex, -in or -pcap (and -frame) flag")
+}
+
+// parseResolver parses an ip:port into the resolver of the config.
+func parseResolver(address string) (models.Resolver, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return models.Resolver{}, fmt.Errorf("-resolver must be in the form ip:port: %w", err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return models.Resolver{}, fmt.Errorf("-resolver port is not a number: %s", port)
+	}
+	return models.Resolver{IP: host, Port: portNumber}, nil
+}
+
+// verifyCraft crafts the message from the config and compares it to the original.
+func verifyCraft(config models.DNSRequest, raw []byte) {
+	crafted, _, _, _, err := crafter.Craft(config)
+	if err != nil {
+		log.Printf("Import: ⚠️  The config doesn't craft, %v", err)
+		return
+	}
+
+	if string(crafted) == string(raw) {
+		log.Printf("Import: ✅ The config crafts the exact same %d bytes", len(raw))
+		return
+	}
+
+	first := 0
+	for first < min(len(crafted), len(raw)) && crafted[first] == raw[first] {
+		first++
+	}
+	log.Printf("Import: ⚠️  The config crafts %d bytes (the message is %d), the first difference is at offset %d", len(crafted), len(raw), first)
+}
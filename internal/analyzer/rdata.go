@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"fmt"
+	"github.com/faanross/spinnekop/internal/wire"
 	"github.com/miekg/dns"
 	"regexp"
 	"strings"
@@ -37,7 +38,7 @@ func AnalyzeRDATA(rr dns.RR) *RDATAAnalysis {
 	analysis := &RDATAAnalysis{
 		HexDetected:    detectHex(combinedData),
 		Base64Detected: detectBase64(combinedData),
-		Capacity:       calculateCapacity(txtRecord),
+		Capacity:       CalculateCapacity(txtRecord),
 	}
 
 	return analysis
@@ -104,12 +105,9 @@ func detectBase64(data string) bool {
 	return true
 }
 
-// calculateCapacity calculates the percentage of TXT record capacity used
-func calculateCapacity(txt *dns.TXT) float64 {
-	totalLength := 0
-	for _, str := range txt.Txt {
-		totalLength += len(str)
-	}
+// CalculateCapacity calculates the percentage of TXT record capacity used
+func CalculateCapacity(txt *dns.TXT) float64 {
+	totalLength := txtLength(txt)
 
 	// TXT records can have multiple strings of 255 chars each
 	// But typical single TXT record capacity is 255 bytes
@@ -120,3 +118,41 @@ func calculateCapacity(txt *dns.TXT) float64 {
 
 	return (float64(totalLength) / maxCapacity) * 100.0
 }
+
+// TXTCapacity describes how a single TXT record is filled, as measured by CalculateCapacity.
+type TXTCapacity struct {
+	Name     string
+	Strings  int
+	Bytes    int
+	Capacity float64
+}
+
+// TXTCapacityReport lists the capacity of every TXT record among rrs, in order.
+// The crafter uses this so the payload sizes it reports line up with the analyzer.
+func TXTCapacityReport(rrs []dns.RR) []TXTCapacity {
+	var report []TXTCapacity
+	for _, rr := range rrs {
+		txtRecord, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+
+		report = append(report, TXTCapacity{
+			Name:     txtRecord.Hdr.Name,
+			Strings:  len(txtRecord.Txt),
+			Bytes:    txtLength(txtRecord),
+			Capacity: CalculateCapacity(txtRecord),
+		})
+	}
+	return report
+}
+
+// txtLength returns the number of bytes the strings of a TXT record take up on the wire. miekg
+// holds them in presentation format, where e.g. \DDD and \" stand for a single byte.
+func txtLength(txt *dns.TXT) int {
+	total := 0
+	for _, str := range txt.Txt {
+		total += len(wire.UnescapeTXT(str))
+	}
+	return total
+}
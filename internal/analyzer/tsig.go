@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// TSIGKey is a key to verify TSIG records with.
+type TSIGKey struct {
+	Name      string
+	Algorithm string
+	Secret    string // base64
+}
+
+// ParseTSIGKey parses a key given as [algorithm:]name:secret, the same form dig's -y takes.
+// The algorithm defaults to hmac-sha256.
+func ParseTSIGKey(s string) (TSIGKey, error) {
+	parts := strings.Split(s, ":")
+
+	key := TSIGKey{Algorithm: "hmac-sha256"}
+	switch len(parts) {
+	case 2:
+		key.Name, key.Secret = parts[0], parts[1]
+	case 3:
+		key.Algorithm, key.Name, key.Secret = parts[0], parts[1], parts[2]
+	default:
+		return key, fmt.Errorf("TSIG key must be given as [algorithm:]name:secret")
+	}
+
+	if _, ok := models.TSIGAlgorithmMap[key.Algorithm]; !ok {
+		return key, fmt.Errorf("unsupported TSIG algorithm: %s", key.Algorithm)
+	}
+	if _, ok := dns.IsDomainName(key.Name); !ok || key.Name == "" {
+		return key, fmt.Errorf("invalid TSIG key name: %s", key.Name)
+	}
+	return key, nil
+}
+
+// VerifyTSIG verifies the TSIG record at the end of a raw message with key. requestMAC
+// is the hex MAC of the request, when verifying a response to a signed request.
+// A MAC that's valid, but signed at a time outside the fudge, is reported as such,
+// since a capture is usually analyzed well after it was signed.
+func VerifyTSIG(raw []byte, tsig *dns.TSIG, key TSIGKey, requestMAC string) error {
+	if !strings.EqualFold(dns.Fqdn(tsig.Hdr.Name), dns.Fqdn(key.Name)) {
+		return fmt.Errorf("signed with key %s, not %s", tsig.Hdr.Name, dns.Fqdn(key.Name))
+	}
+	if !strings.EqualFold(tsig.Algorithm, models.TSIGAlgorithmMap[key.Algorithm]) {
+		return fmt.Errorf("signed with algorithm %s, not %s", tsig.Algorithm, key.Algorithm)
+	}
+
+	// miekg strips the TSIG record in place, so it gets a copy
+	err := dns.TsigVerify(bytes.Clone(raw), key.Secret, requestMAC, false)
+	if errors.Is(err, dns.ErrTime) {
+		return fmt.Errorf("MAC is valid, but the time signed is more than the fudge (%ds) from now", tsig.Fudge)
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+// Package capture writes crafted messages to synthetic captures, wrapped in the Ethernet,
+// IP and UDP headers they'd have had on the wire, so they can be read by the analyzer,
+// Wireshark or an IDS without ever being sent.
+package capture
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOutput        = "spinnekop.pcap"
+	defaultClientIP      = "192.0.2.10" // TEST-NET-1 (RFC 5737)
+	defaultServerIP      = "192.0.2.53"
+	defaultClientPort    = 49152 // The first port of the ephemeral range
+	defaultServerPort    = 53
+	defaultClientMAC     = "02:00:00:00:00:01" // Locally administered, so they never clash with real ones
+	defaultServerMAC     = "02:00:00:00:00:02"
+	defaultResponseDelay = 10 * time.Millisecond
+
+	// ttl is the IPv4 TTL and IPv6 hop limit of every packet
+	ttl = 64
+)
+
+// Endpoint is one side of the exchange.
+type Endpoint struct {
+	MAC  net.HardwareAddr
+	IP   net.IP
+	Port uint16
+}
+
+// Packet is a DNS message along with where, and when, it was (supposedly) seen.
+type Packet struct {
+	Time    time.Time
+	Src     Endpoint
+	Dst     Endpoint
+	Payload []byte
+}
+
+// Output returns the file the capture is written to and its format.
+func Output(cfg models.Capture) (string, string) {
+	output := cfg.Output
+	if output == "" {
+		output = defaultOutput
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = "pcap"
+		if strings.HasSuffix(strings.ToLower(output), ".pcapng") {
+			format = "pcapng"
+		}
+	}
+	return output, format
+}
+
+// Endpoints returns the client and the server of the exchange, filling in the defaults.
+// Unless the config says otherwise, the server is the resolver the message would've been sent to.
+func Endpoints(cfg models.Capture, resolver models.Resolver) (Endpoint, Endpoint, error) {
+	serverIP, serverPort := defaultServerIP, defaultServerPort
+	if !resolver.UseSystemDefaults {
+		if resolver.IP != "" {
+			serverIP = resolver.IP
+		}
+		if resolver.Port > 0 {
+			serverPort = resolver.Port
+		}
+	}
+
+	client, err := endpoint("client", cfg.ClientMAC, defaultClientMAC, cfg.ClientIP, defaultClientIP, cfg.ClientPort, defaultClientPort)
+	if err != nil {
+		return Endpoint{}, Endpoint{}, err
+	}
+	server, err := endpoint("server", cfg.ServerMAC, defaultServerMAC, cfg.ServerIP, serverIP, cfg.ServerPort, serverPort)
+	if err != nil {
+		return Endpoint{}, Endpoint{}, err
+	}
+
+	if (client.IP.To4() == nil) != (server.IP.To4() == nil) {
+		return Endpoint{}, Endpoint{}, fmt.Errorf("client (%s) and server (%s) must both be IPv4 or both be IPv6", client.IP, server.IP)
+	}
+	return client, server, nil
+}
+
+// endpoint parses one side of the exchange, using the defaults for whatever is left empty.
+func endpoint(side string, mac string, defaultMAC string, ip string, defaultIP string, port int, defaultPort int) (Endpoint, error) {
+	if mac == "" {
+		mac = defaultMAC
+	}
+	if ip == "" {
+		ip = defaultIP
+	}
+	if port == 0 {
+		port = defaultPort
+	}
+
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil || len(hwAddr) != 6 {
+		return Endpoint{}, fmt.Errorf("%s_mac: not a valid Ethernet address: %s", side, mac)
+	}
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return Endpoint{}, fmt.Errorf("%s_ip: not a valid IP address: %s", side, ip)
+	}
+	if port < 1 || port > 65535 {
+		return Endpoint{}, fmt.Errorf("%s_port: not a valid port number: %d", side, port)
+	}
+
+	return Endpoint{MAC: hwAddr, IP: parsedIP, Port: uint16(port)}, nil
+}
+
+// Start returns the time of the first packet, the current time unless the config sets one.
+func Start(cfg models.Capture) (time.Time, error) {
+	if cfg.Timestamp == "" {
+		return time.Now(), nil
+	}
+	start, err := time.Parse(time.RFC3339Nano, cfg.Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp: must be in RFC 3339 format (e.g. 2025-01-01T12:00:00Z): %w", err)
+	}
+	return start, nil
+}
+
+// Exchange lays out the messages as they'd go back and forth between the client and the server:
+// queries from the client to the server, responses (QR set) the other way around. Every
+// message follows the one before it after the response delay.
+func Exchange(cfg models.Capture, resolver models.Resolver, msgs ...[]byte) ([]Packet, error) {
+	client, server, err := Endpoints(cfg, resolver)
+	if err != nil {
+		return nil, err
+	}
+	at, err := Start(cfg)
+	if err != nil {
+		return nil, err
+	}
+	delay := defaultResponseDelay
+	if cfg.ResponseDelay > 0 {
+		delay = time.Duration(cfg.ResponseDelay) * time.Millisecond
+	}
+
+	var packets []Packet
+	for _, msg := range msgs {
+		// QR is the top bit of the flags (byte 2 of the DNS header)
+		src, dst := client, server
+		if len(msg) > 2 && msg[2]&0x80 != 0 {
+			src, dst = server, client
+		}
+		packets = append(packets, Packet{Time: at, Src: src, Dst: dst, Payload: msg})
+		at = at.Add(delay)
+	}
+	return packets, nil
+}
+
+// Frame wraps the packet's payload in Ethernet, IPv4 or IPv6 (following the addresses) and
+// UDP headers, with the lengths and checksums filled in.
+func Frame(p Packet) ([]byte, error) {
+	eth := &layers.Ethernet{SrcMAC: p.Src.MAC, DstMAC: p.Dst.MAC}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(p.Src.Port), DstPort: layers.UDPPort(p.Dst.Port)}
+
+	// The IP header's length field has to hold the UDP header and the payload as well
+	var ip gopacket.SerializableLayer
+	maxPayload := 0xFFFF - 8
+	if src, dst := p.Src.IP.To4(), p.Dst.IP.To4(); src != nil && dst != nil {
+		eth.EthernetType = layers.EthernetTypeIPv4
+		ipv4 := &layers.IPv4{
+			Version:  4,
+			TTL:      ttl,
+			Flags:    layers.IPv4DontFragment,
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    src,
+			DstIP:    dst,
+		}
+		if err := udp.SetNetworkLayerForChecksum(ipv4); err != nil {
+			return nil, err
+		}
+		ip = ipv4
+		maxPayload -= 20
+	} else {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ipv6 := &layers.IPv6{
+			Version:    6,
+			HopLimit:   ttl,
+			NextHeader: layers.IPProtocolUDP,
+			SrcIP:      p.Src.IP.To16(),
+			DstIP:      p.Dst.IP.To16(),
+		}
+		if err := udp.SetNetworkLayerForChecksum(ipv6); err != nil {
+			return nil, err
+		}
+		ip = ipv6
+	}
+
+	if len(p.Payload) > maxPayload {
+		return nil, fmt.Errorf("a message of %d bytes doesn't fit in a single UDP datagram (at most %d)", len(p.Payload), maxPayload)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(p.Payload)); err != nil {
+		return nil, fmt.Errorf("failed to build frame: %w", err)
+	}
+	return buf.Bytes(), nil
+}
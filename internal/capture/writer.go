@@ -0,0 +1,126 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"os"
+)
+
+// snapLen is the snapshot length written to pcap headers, large enough for any frame we build.
+const snapLen = 262144
+
+var (
+	// pcapMagic and pcapngMagic are the first bytes of pcap (little-endian, microseconds)
+	// and pcapng files, which is how we tell what a file we append to holds
+	pcapMagic   = []byte{0xd4, 0xc3, 0xb2, 0xa1}
+	pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+)
+
+// packetWriter is what the pcap and pcapng writers have in common.
+type packetWriter interface {
+	WritePacket(ci gopacket.CaptureInfo, data []byte) error
+}
+
+// Write frames the packets and writes them to the file at path, in the given format (pcap or pcapng).
+// If appendFile is set and the file already exists, the packets are added to the end of it: in a
+// pcap they follow the existing packets, in a pcapng they go in a section of their own.
+func Write(path string, format string, appendFile bool, packets []Packet) error {
+	if format != "pcap" && format != "pcapng" {
+		return fmt.Errorf("format must be pcap or pcapng, but got %s", format)
+	}
+
+	existing := false
+	if appendFile {
+		var err error
+		existing, err = checkExisting(path, format)
+		if err != nil {
+			return err
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if existing {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	var w packetWriter
+	var ngWriter *pcapgo.NgWriter
+	if format == "pcapng" {
+		// Every writer starts a new section, which is all appending to a pcapng takes
+		ngWriter, err = pcapgo.NewNgWriter(file, layers.LinkTypeEthernet)
+		if err != nil {
+			return fmt.Errorf("failed to write pcapng header: %w", err)
+		}
+		w = ngWriter
+	} else {
+		pcapWriter := pcapgo.NewWriter(file)
+		if !existing {
+			if err := pcapWriter.WriteFileHeader(snapLen, layers.LinkTypeEthernet); err != nil {
+				return fmt.Errorf("failed to write pcap header: %w", err)
+			}
+		}
+		w = pcapWriter
+	}
+
+	for i, p := range packets {
+		frame, err := Frame(p)
+		if err != nil {
+			return fmt.Errorf("packet %d: %w", i, err)
+		}
+		ci := gopacket.CaptureInfo{
+			Timestamp:     p.Time,
+			CaptureLength: len(frame),
+			Length:        len(frame),
+		}
+		if err := w.WritePacket(ci, frame); err != nil {
+			return fmt.Errorf("failed to write packet %d: %w", i, err)
+		}
+	}
+
+	if ngWriter != nil {
+		if err := ngWriter.Flush(); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", path, err)
+		}
+	}
+	return file.Close()
+}
+
+// checkExisting reports whether there's a (non-empty) file at path to append to, and makes
+// sure it's in the same format. A pcap also has to hold Ethernet frames, like ours.
+func checkExisting(path string, format string) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 24)
+	n, err := io.ReadFull(file, header)
+	if n == 0 {
+		return false, nil
+	}
+
+	switch {
+	case format == "pcapng" && bytes.HasPrefix(header[:n], pcapngMagic):
+		return true, nil
+	case format == "pcap" && err == nil && bytes.HasPrefix(header, pcapMagic):
+		if linkType := binary.LittleEndian.Uint32(header[20:24]); linkType != uint32(layers.LinkTypeEthernet) {
+			return false, fmt.Errorf("can't append to '%s', it holds link type %d rather than Ethernet", path, linkType)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("can't append to '%s', it isn't a %s file (or not one we can add to)", path, format)
+}
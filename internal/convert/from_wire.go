@@ -0,0 +1,458 @@
+// Package convert turns DNS messages back into configs, the reverse of what the crafter does.
+// This lets a packet seen in a capture serve as the starting point for crafting.
+package convert
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+const (
+	// maxTXTString is the longest character-string a TXT record can hold
+	maxTXTString = 255
+
+	// rootQuestionLength is the length of a question for the root: the empty name, type and class
+	rootQuestionLength = 5
+)
+
+// converter holds the message being converted, along with what we learn along the way.
+type converter struct {
+	raw []byte
+
+	// pointers: The compression pointers of the owner names, in the order they appear
+	pointers []models.PointerInjection
+
+	// labels: Whether any name had to be given as labels
+	labels bool
+
+	// notes: Anything that couldn't be kept as it was
+	notes []string
+}
+
+// FromWire converts a raw DNS message into a config that crafts the same message. Everything
+// the config can express is kept as-is: the header flags (Z included), custom opcodes, types
+// and classes, header counts that don't match the sections, compression pointers in owner
+// names, records past the declared counts and trailing bytes. RDATA is given in presentation
+// format if that packs to the same bytes, and in RFC 3597 generic encoding otherwise.
+// It returns notes on anything that couldn't be kept.
+func FromWire(raw []byte) (models.DNSRequest, []string, error) {
+	layout, err := wire.Walk(raw)
+	if err != nil {
+		return models.DNSRequest{}, nil, err
+	}
+
+	c := &converter{raw: raw}
+	req := models.DNSRequest{
+		Header:   c.header(),
+		Resolver: models.Resolver{UseSystemDefaults: true},
+	}
+
+	// QUESTIONS
+	var questions []models.Question
+	for i, q := range layout.Questions {
+		questions = append(questions, c.question(fmt.Sprintf("question[%d]", i), q))
+	}
+	switch len(questions) {
+	case 0:
+		// The crafter always packs at least one question, the smallest one we can give it
+		req.Question = models.Question{Name: ".", Type: "A", StdType: true, Class: "IN", StdClass: true}
+	case 1:
+		req.Question = questions[0]
+	default:
+		req.Questions = questions
+	}
+
+	// RECORDS
+	// Answers are only packed for responses and NOTIFY, a query carrying them would lose them
+	answers := layout.Answers
+	if len(answers) > 0 && !crafter.PacksAnswers(req.Header) {
+		c.note(fmt.Sprintf("%d answer record(s) dropped, the crafter only packs answers for responses and NOTIFY", len(answers)))
+		answers = nil
+	}
+	req.Answers = c.records("answer", answers)
+	req.Authority = c.records("authority", layout.Authority)
+
+	// Records past the declared counts come right after the additional section, which
+	// is exactly where they end up as more additional records (the counts are overridden)
+	additional := append(append([]wire.Record(nil), layout.Additional...), layout.Extra...)
+
+	// The first OPT record becomes the EDNS block, which the crafter puts after the additional
+	// records. Anything after it (e.g. a TSIG we can't sign again without the secret) is appended
+	// as-is, as is an OPT record we can't convert: miekg can't pack an OPT it didn't build itself.
+	tail := layout.End
+	for i, r := range additional {
+		if binary.BigEndian.Uint16(raw[r.TypeOffset:]) != dns.TypeOPT {
+			continue
+		}
+		if edns, ok := c.edns(r); ok {
+			req.EDNS = edns
+			tail = r.End
+		} else {
+			tail = r.NameOffset
+			c.note(fmt.Sprintf("the OPT record at offset %d isn't valid EDNS, it's appended as-is", r.NameOffset))
+		}
+		if after := len(additional) - i - 1; after > 0 {
+			c.note(fmt.Sprintf("%d record(s) after the OPT record are appended as-is", after))
+		}
+		additional = additional[:i]
+		break
+	}
+	req.Additional = c.records("additional", additional)
+
+	// COUNTS
+	// The crafter's counts follow the config, where they differ from the message we override them
+	crafted := wire.Counts{
+		QD: uint16(max(1, len(questions))),
+		AN: uint16(len(req.Answers)),
+		NS: uint16(len(req.Authority)),
+		AR: uint16(len(req.Additional)),
+	}
+	if req.EDNS != nil {
+		crafted.AR++
+	}
+	req.Header.CountOverrides = countOverrides(layout.Declared, crafted)
+
+	// Names are given as labels when they can't be given as a name, which the limits have to allow
+	req.AllowViolations = c.labels
+
+	if len(c.pointers) > 0 {
+		req.Compression = &models.Compression{Mode: "off", Pointers: c.pointers}
+	}
+
+	// TRAILING DATA
+	// Whatever comes after the last converted record is appended as-is. If that's everything after
+	// the header, the root question the crafter packs there is overwritten with its first bytes.
+	if len(questions) == 0 {
+		if tail == wire.HeaderLength && len(raw)-tail >= rootQuestionLength {
+			offset := uint16(tail)
+			req.Patches = append(req.Patches, models.Patch{Offset: &offset, Bytes: hex.EncodeToString(raw[tail : tail+rootQuestionLength])})
+			tail += rootQuestionLength
+		} else {
+			c.note("the message has no questions, but the config always crafts one (the root, type A)")
+		}
+	}
+	if tail < len(raw) {
+		req.Patches = append(req.Patches, models.Patch{Append: hex.EncodeToString(raw[tail:])})
+		if layout.Err != nil {
+			c.note(fmt.Sprintf("%d byte(s) after offset %d can't be parsed (%v), they're kept as raw bytes", len(raw)-layout.End, layout.End, layout.Err))
+		}
+	}
+
+	return req, c.notes, nil
+}
+
+// note records something that couldn't be kept.
+func (c *converter) note(note string) {
+	c.notes = append(c.notes, note)
+}
+
+// header converts the 12-byte header. The ID is kept with a constant ID strategy,
+// so even an ID of 0 is sent as-is.
+func (c *converter) header() models.Header {
+	flags := binary.BigEndian.Uint16(c.raw[2:4])
+
+	header := models.Header{
+		ID:                 binary.BigEndian.Uint16(c.raw[0:2]),
+		IDStrategy:         &models.IDStrategy{Mode: "constant"},
+		QR:                 flags&0x8000 != 0,
+		Authoritative:      flags&0x0400 != 0,
+		Truncated:          flags&0x0200 != 0,
+		RecursionDesired:   flags&0x0100 != 0,
+		RecursionAvailable: flags&0x0080 != 0,
+		Z:                  uint8(flags >> 6 & 0x1),
+		AuthenticatedData:  flags&0x0020 != 0,
+		CheckingDisabled:   flags&0x0010 != 0,
+		RCode:              uint8(flags & 0xF),
+	}
+
+	opCode := int(flags >> 11 & 0xF)
+	if name, ok := dns.OpcodeToString[opCode]; ok {
+		if _, std := models.OpCodeMap[name]; std {
+			header.OpCode = name
+			header.StdOpCode = true
+			return header
+		}
+	}
+	header.CustomOpCode = uint8(opCode)
+
+	return header
+}
+
+// question converts a single question, ref is how the crafter refers to its name (e.g. "question[0]").
+func (c *converter) question(ref string, q wire.Question) models.Question {
+	question := models.Question{}
+	question.Name, question.Labels = c.name(ref, q.NameOffset)
+
+	qType := binary.BigEndian.Uint16(c.raw[q.TypeOffset:])
+	if name, ok := typeName(qType); ok {
+		question.Type = name
+		question.StdType = true
+	} else {
+		question.CustomType = qType
+	}
+
+	qClass := binary.BigEndian.Uint16(c.raw[q.ClassOffset:])
+	if name, ok := className(qClass); ok {
+		question.Class = name
+		question.StdClass = true
+	} else {
+		question.CustomClass = qClass
+	}
+
+	return question
+}
+
+// records converts the records of a section.
+func (c *converter) records(section string, records []wire.Record) []models.Answer {
+	var answers []models.Answer
+	for i, r := range records {
+		answers = append(answers, c.record(fmt.Sprintf("%s[%d]", section, i), r))
+	}
+	return answers
+}
+
+// record converts a single record, ref is how the crafter refers to its owner name (e.g. "answer[1]").
+func (c *converter) record(ref string, r wire.Record) models.Answer {
+	answer := models.Answer{
+		TTL: binary.BigEndian.Uint32(c.raw[r.TTLOffset:]),
+	}
+	answer.Name, answer.Labels = c.name(ref, r.NameOffset)
+
+	class := binary.BigEndian.Uint16(c.raw[r.ClassOffset:])
+	if name, ok := className(class); ok {
+		answer.Class = name
+		answer.StdClass = true
+	} else {
+		answer.CustomClass = class
+	}
+
+	rrType := binary.BigEndian.Uint16(c.raw[r.TypeOffset:])
+	name, known := typeName(rrType)
+
+	// Pseudo-records are never given as data, their RDATA is kept byte-for-byte
+	if known && rrType != dns.TypeOPT && rrType != dns.TypeTSIG {
+		if data, txt, ok := c.presentation(r, name); ok {
+			answer.Type = name
+			answer.Data = data
+			answer.TXT = txt
+			return answer
+		}
+	}
+
+	if known {
+		answer.Type = name
+	} else {
+		answer.TypeCode = rrType
+	}
+	rdata := c.raw[r.RDataOffset:r.End]
+	answer.RawRData = strings.TrimSpace(fmt.Sprintf(`\# %d %s`, len(rdata), hex.EncodeToString(rdata)))
+
+	return answer
+}
+
+// presentation returns the RDATA of the record in presentation format, but only if it
+// packs to exactly the same bytes. That isn't the case for RDATA that's malformed,
+// has trailing bytes, or holds compressed names (miekg never compresses RDATA for us).
+func (c *converter) presentation(r wire.Record, typeName string) (string, *models.TXTOptions, bool) {
+	rr, _, err := dns.UnpackRR(c.raw, r.NameOffset)
+	if err != nil || rr == nil {
+		return "", nil, false
+	}
+	original := string(c.raw[r.RDataOffset:r.End])
+
+	// TXT data is given as the text itself, which the crafter cuts back into the same strings
+	if txt, ok := rr.(*dns.TXT); ok {
+		if packRData(rr) != original {
+			return "", nil, false
+		}
+		return txtData(txt.Txt)
+	}
+
+	data := strings.TrimPrefix(rr.String(), rr.Header().String())
+	rebuilt, err := dns.NewRR(fmt.Sprintf(". 0 IN %s %s", typeName, data))
+	if err != nil || rebuilt == nil || packRData(rebuilt) != original {
+		return "", nil, false
+	}
+	return data, nil, true
+}
+
+// packRData packs the RDATA of rr, without compression. It returns an empty string if it can't be packed.
+func packRData(rr dns.RR) string {
+	// With the root as the owner name, the header takes up the first 11 bytes
+	rr.Header().Name = "."
+
+	buf := make([]byte, dns.MaxMsgSize)
+	n, err := dns.PackRR(rr, buf, 0, nil, false)
+	if err != nil {
+		return ""
+	}
+	return string(buf[11:n])
+}
+
+// txtData joins the strings of a TXT record into its data, if the crafter cuts that data
+// back into the same strings: all of the same length, but for a shorter last one.
+func txtData(strs []string) (string, *models.TXTOptions, bool) {
+	// Escaped strings (quotes, backslashes, binary bytes) would be cut in the wrong places
+	for _, s := range strs {
+		if strings.Contains(s, `\`) {
+			return "", nil, false
+		}
+	}
+
+	size := len(strs[0])
+	for i, s := range strs {
+		last := i == len(strs)-1
+		if (!last && len(s) != size) || (last && len(strs) > 1 && (len(s) == 0 || len(s) > size)) {
+			return "", nil, false
+		}
+	}
+
+	var txt *models.TXTOptions
+	if len(strs) > 1 && size != maxTXTString {
+		txt = &models.TXTOptions{ChunkSize: size}
+	}
+	return strings.Join(strs, ""), txt, true
+}
+
+// name converts the name at off. A name that ends in a compression pointer is given in full,
+// along with the pointer to write in place of its tail. Names that miekg can't unpack (e.g.
+// pointer loops or reserved label types) are given as the labels before the pointer, if any.
+func (c *converter) name(ref string, off int) (string, []models.Label) {
+	start := off
+	var labels []models.Label
+
+	for off < len(c.raw) {
+		length := int(c.raw[off])
+		if length == 0 {
+			break
+		}
+
+		if length&0xC0 == 0xC0 {
+			if off+1 >= len(c.raw) {
+				break
+			}
+			c.pointers = append(c.pointers, models.PointerInjection{
+				Name:       ref,
+				KeepLabels: len(labels),
+				Kind:       "offset",
+				Offset:     binary.BigEndian.Uint16(c.raw[off:]) & 0x3FFF,
+			})
+			break
+		}
+
+		end := off + 1 + length
+		if end > len(c.raw) {
+			break
+		}
+		labels = append(labels, label(c.raw[off+1:end]))
+		off = end
+	}
+
+	name, _, err := dns.UnpackDomainName(c.raw, start)
+	if err == nil {
+		return name, nil
+	}
+
+	if len(labels) == 0 {
+		// Labels can't be empty, the root name is the closest we get
+		return ".", nil
+	}
+	c.labels = true
+	return "", labels
+}
+
+// label converts the bytes of a single label, as text if they're all printable.
+func label(data []byte) models.Label {
+	for _, b := range data {
+		if b <= ' ' || b > '~' {
+			return models.Label{Hex: hex.EncodeToString(data)}
+		}
+	}
+	return models.Label{Text: string(data)}
+}
+
+// edns converts an OPT record into the EDNS block. Every option is kept as a custom
+// option with its raw payload, so it's written back byte-for-byte.
+func (c *converter) edns(r wire.Record) (*models.EDNS, bool) {
+	if binary.BigEndian.Uint16(c.raw[r.TypeOffset:]) != dns.TypeOPT || c.raw[r.NameOffset] != 0 {
+		return nil, false
+	}
+
+	ttl := binary.BigEndian.Uint32(c.raw[r.TTLOffset:])
+	edns := &models.EDNS{
+		UDPSize:       binary.BigEndian.Uint16(c.raw[r.ClassOffset:]),
+		ExtendedRCode: uint8(ttl >> 24),
+		Version:       uint8(ttl >> 16),
+		DO:            ttl&0x8000 != 0,
+		Z:             uint16(ttl & 0x7FFF),
+	}
+
+	rdata := c.raw[r.RDataOffset:r.End]
+	for len(rdata) > 0 {
+		if len(rdata) < 4 {
+			return nil, false
+		}
+		code := binary.BigEndian.Uint16(rdata[0:2])
+		length := int(binary.BigEndian.Uint16(rdata[2:4]))
+		if 4+length > len(rdata) {
+			return nil, false
+		}
+		edns.Options = append(edns.Options, models.EDNSOption{
+			Type: "CUSTOM",
+			Code: code,
+			Data: hex.EncodeToString(rdata[4 : 4+length]),
+		})
+		rdata = rdata[4+length:]
+	}
+
+	return edns, true
+}
+
+// countOverrides returns the overrides for the counts the crafter gets wrong, or nil if it gets them all right.
+func countOverrides(declared wire.Counts, crafted wire.Counts) *models.CountOverrides {
+	override := func(declared, crafted uint16) *uint16 {
+		if declared == crafted {
+			return nil
+		}
+		return &declared
+	}
+
+	overrides := &models.CountOverrides{
+		QDCount: override(declared.QD, crafted.QD),
+		ANCount: override(declared.AN, crafted.AN),
+		NSCount: override(declared.NS, crafted.NS),
+		ARCount: override(declared.AR, crafted.AR),
+	}
+	if *overrides == (models.CountOverrides{}) {
+		return nil
+	}
+	return overrides
+}
+
+// typeName returns the name of a type, if it's one in QTypeMap.
+func typeName(rrType uint16) (string, bool) {
+	name, ok := dns.TypeToString[rrType]
+	if !ok {
+		return "", false
+	}
+	if code, ok := models.QTypeMap[name]; ok && code == rrType {
+		return name, true
+	}
+	return "", false
+}
+
+// className returns the name of a class, if it's one in QClassMap.
+func className(class uint16) (string, bool) {
+	for name, code := range models.QClassMap {
+		if code == class {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,163 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/validate"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+// testSecret is the (base64) TSIG secret of the signed test message
+const testSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+
+// newRR parses a record in zone-file format, failing the test if it doesn't parse.
+func newRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return rr
+}
+
+// pack packs msg, failing the test if it doesn't pack.
+func pack(t *testing.T, msg *dns.Msg) []byte {
+	t.Helper()
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack message: %v", err)
+	}
+	return raw
+}
+
+// compressedResponse is a response whose owner names and RDATA share compressed suffixes.
+func compressedResponse(t *testing.T) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	msg.Id = 0x1234
+	msg.Response = true
+	msg.Authoritative = true
+	msg.Answer = []dns.RR{
+		newRR(t, "www.example.com. 300 IN CNAME web.example.com."),
+		newRR(t, "web.example.com. 300 IN A 192.0.2.1"),
+	}
+	msg.Ns = []dns.RR{newRR(t, "example.com. 3600 IN NS ns1.example.com.")}
+	msg.Extra = []dns.RR{newRR(t, "ns1.example.com. 3600 IN A 192.0.2.53")}
+	msg.Compress = true
+	return pack(t, msg)
+}
+
+// signedQuery is a query with an OPT record, signed with TSIG (which goes after the OPT).
+func signedQuery(t *testing.T) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeSOA)
+	msg.Id = 0xbeef
+	msg.SetEdns0(1232, true)
+	msg.SetTsig("key.example.com.", dns.HmacSHA256, 300, 1700000000)
+
+	raw, _, err := dns.TsigGenerate(msg, testSecret, "", false)
+	if err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+	return raw
+}
+
+// lyingCounts is a response whose ANCOUNT leaves out its second answer, followed by trailing bytes.
+func lyingCounts(t *testing.T) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Id = 7
+	msg.Response = true
+	msg.Answer = []dns.RR{
+		newRR(t, "example.com. 60 IN A 192.0.2.1"),
+		newRR(t, "example.com. 60 IN A 192.0.2.2"),
+	}
+	raw := pack(t, msg)
+	binary.BigEndian.PutUint16(raw[6:8], 1)
+	return append(raw, 0xde, 0xad)
+}
+
+// inflatedCounts is a query whose header claims more answers and authority records than it holds.
+func inflatedCounts(t *testing.T) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeTXT)
+	msg.Id = 8
+	raw := pack(t, msg)
+	binary.BigEndian.PutUint16(raw[6:8], 3)
+	binary.BigEndian.PutUint16(raw[8:10], 1)
+	return raw
+}
+
+// escapedData is a response with a space in its name and TXT data that needs escaping.
+func escapedData(t *testing.T) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion(`a\ b.example.com.`, dns.TypeTXT)
+	msg.Id = 9
+	msg.Response = true
+	msg.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: `a\ b.example.com.`, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+		Txt: []string{`quote\" backslash\\ binary\000\255`},
+	}}
+	return pack(t, msg)
+}
+
+// TestFromWireRoundTrip converts messages into configs, and checks that those configs (also after
+// a trip through YAML, like cmd/import writes them) validate and craft the exact same bytes.
+func TestFromWireRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(t *testing.T) []byte
+		notes int // The TSIG after the OPT record is appended as-is, with a note
+	}{
+		{"compressed response", compressedResponse, 0},
+		{"OPT and TSIG", signedQuery, 1},
+		{"count too low and trailing bytes", lyingCounts, 0},
+		{"counts too high", inflatedCounts, 0},
+		{"escaped name and TXT data", escapedData, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.build(t)
+
+			config, notes, err := FromWire(raw)
+			if err != nil {
+				t.Fatalf("FromWire failed: %v", err)
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("got %d note(s), want %d: %v", len(notes), tt.notes, notes)
+			}
+			checkCraft(t, "config", config, raw)
+
+			out, err := yaml.Marshal(config)
+			if err != nil {
+				t.Fatalf("failed to marshal config: %v", err)
+			}
+			var fromYAML models.DNSRequest
+			if err := yaml.Unmarshal(out, &fromYAML); err != nil {
+				t.Fatalf("failed to unmarshal config: %v", err)
+			}
+			checkCraft(t, "YAML config", fromYAML, raw)
+		})
+	}
+}
+
+// checkCraft validates the config and checks that it crafts raw.
+func checkCraft(t *testing.T, what string, config models.DNSRequest, raw []byte) {
+	t.Helper()
+
+	if err := validate.ValidateRequest(&config); err != nil {
+		t.Fatalf("%s doesn't validate: %v", what, err)
+	}
+	crafted, _, _, _, err := crafter.Craft(config)
+	if err != nil {
+		t.Fatalf("%s doesn't craft: %v", what, err)
+	}
+	if !bytes.Equal(crafted, raw) {
+		t.Errorf("%s crafts a different message\n got: %x\nwant: %x", what, crafted, raw)
+	}
+}
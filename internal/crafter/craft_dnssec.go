@@ -0,0 +1,376 @@
+package crafter
+
+import (
+	"crypto"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultValidity is how long signatures are valid for, unless DNSSEC.Validity says otherwise
+	defaultValidity = 14 * 24 * 60 * 60
+
+	// dnssecTTL is the TTL of the DNSKEY, DS and NSEC/NSEC3 records we add
+	dnssecTTL = 3600
+)
+
+// dnssecKeys holds the keys a response is signed with. With a key file,
+// the KSK and ZSK are one and the same.
+type dnssecKeys struct {
+	ksk, zsk               *dns.DNSKEY
+	kskPrivate, zskPrivate crypto.Signer
+}
+
+// ApplyDNSSEC adds the DNSKEY, DS and NSEC/NSEC3 records the config asks for, then signs
+// every RRset in the answer and authority sections. The RRSIGs go at the end of their section,
+// after the records from the config, so those keep their position on the wire.
+func ApplyDNSSEC(msg *dns.Msg, dnssec *models.DNSSEC) error {
+	if dnssec == nil {
+		return nil
+	}
+
+	zone := dns.Fqdn(dnssec.Zone)
+
+	keys, err := loadDNSSECKeys(dnssec, zone)
+	if err != nil {
+		return err
+	}
+
+	if dnssec.DNSKEY {
+		msg.Answer = append(msg.Answer, keys.ksk)
+		if keys.zsk != keys.ksk {
+			msg.Answer = append(msg.Answer, keys.zsk)
+		}
+	}
+
+	if dnssec.DS {
+		ds := keys.ksk.ToDS(dns.SHA256)
+		if ds == nil {
+			return fmt.Errorf("failed to create DS record for key %d", keys.ksk.KeyTag())
+		}
+		ds.Hdr.Ttl = dnssecTTL
+		msg.Ns = append(msg.Ns, ds)
+	}
+
+	if dnssec.Denial != "" {
+		if len(msg.Question) == 0 {
+			return fmt.Errorf("denial needs a question name")
+		}
+		denial, err := buildDenial(dnssec, zone, msg.Question[0].Name, msg.Answer)
+		if err != nil {
+			return err
+		}
+		msg.Ns = append(msg.Ns, denial)
+	}
+
+	inception, expiration, err := signatureWindow(dnssec)
+	if err != nil {
+		return err
+	}
+
+	sign := func(rrs []dns.RR) ([]dns.RR, error) {
+		var sigs []dns.RR
+		for _, rrset := range groupRRsets(rrs) {
+			// The DNSKEY RRset is signed by the KSK, everything else by the ZSK
+			key, private := keys.zsk, keys.zskPrivate
+			if rrset[0].Header().Rrtype == dns.TypeDNSKEY {
+				key, private = keys.ksk, keys.kskPrivate
+			}
+
+			rrsig := &dns.RRSIG{
+				Hdr: dns.RR_Header{
+					Name:   rrset[0].Header().Name,
+					Rrtype: dns.TypeRRSIG,
+					Class:  rrset[0].Header().Class,
+					Ttl:    rrset[0].Header().Ttl,
+				},
+				Algorithm:  key.Algorithm,
+				KeyTag:     key.KeyTag(),
+				SignerName: zone,
+				Inception:  inception,
+				Expiration: expiration,
+			}
+			if err := rrsig.Sign(private, rrset); err != nil {
+				return nil, fmt.Errorf("failed to sign %s %s: %w", rrset[0].Header().Name, dns.TypeToString[rrset[0].Header().Rrtype], err)
+			}
+
+			if dnssec.Signatures == "mismatched" {
+				if err := corruptSignature(rrsig); err != nil {
+					return nil, err
+				}
+			}
+			sigs = append(sigs, rrsig)
+		}
+		return append(rrs, sigs...), nil
+	}
+
+	if msg.Answer, err = sign(msg.Answer); err != nil {
+		return fmt.Errorf("answer: %w", err)
+	}
+	if msg.Ns, err = sign(msg.Ns); err != nil {
+		return fmt.Errorf("authority: %w", err)
+	}
+
+	return nil
+}
+
+// loadDNSSECKeys reads the key pair from the key file, or generates an ephemeral KSK and ZSK.
+func loadDNSSECKeys(dnssec *models.DNSSEC, zone string) (*dnssecKeys, error) {
+	if dnssec.KeyFile != "" {
+		key, private, err := readKeyFile(dnssec.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &dnssecKeys{ksk: key, zsk: key, kskPrivate: private, zskPrivate: private}, nil
+	}
+
+	algorithmName := dnssec.Algorithm
+	if algorithmName == "" {
+		algorithmName = "ECDSAP256SHA256"
+	}
+	algorithm, ok := models.DNSSECAlgorithmMap[algorithmName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported DNSSEC algorithm: %s", algorithmName)
+	}
+
+	ksk, kskPrivate, err := generateKey(zone, algorithm, dns.ZONE|dns.SEP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate KSK: %w", err)
+	}
+	zsk, zskPrivate, err := generateKey(zone, algorithm, dns.ZONE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ZSK: %w", err)
+	}
+
+	return &dnssecKeys{ksk: ksk, zsk: zsk, kskPrivate: kskPrivate, zskPrivate: zskPrivate}, nil
+}
+
+// readKeyFile reads a BIND key pair, path is given without the .key or .private extension.
+func readKeyFile(path string) (*dns.DNSKEY, crypto.Signer, error) {
+	path = strings.TrimSuffix(strings.TrimSuffix(path, ".key"), ".private")
+
+	public, err := os.Open(path + ".key")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer public.Close()
+
+	rr, err := dns.ReadRR(public, path+".key")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s.key does not hold a DNSKEY record", path)
+	}
+
+	private, err := os.Open(path + ".private")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open private key file: %w", err)
+	}
+	defer private.Close()
+
+	privateKey, err := key.ReadPrivateKey(private, path+".private")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("private key of type %T can't sign", privateKey)
+	}
+
+	return key, signer, nil
+}
+
+// generateKey generates an ephemeral key for the zone.
+func generateKey(zone string, algorithm uint8, flags uint16) (*dns.DNSKEY, crypto.Signer, error) {
+	key := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    dnssecTTL,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+
+	bits := 256
+	switch algorithm {
+	case dns.RSASHA256, dns.RSASHA512:
+		bits = 2048
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	}
+
+	privateKey, err := key.Generate(bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("private key of type %T can't sign", privateKey)
+	}
+
+	return key, signer, nil
+}
+
+// signatureWindow works out the inception and expiration of the signatures.
+func signatureWindow(dnssec *models.DNSSEC) (uint32, uint32, error) {
+	validity := dnssec.Validity
+	if validity == 0 {
+		validity = defaultValidity
+	}
+
+	now := uint32(time.Now().Unix())
+	hour := uint32(60 * 60)
+
+	switch dnssec.Signatures {
+	case "", "valid", "mismatched":
+		return now - hour, now + validity, nil
+	case "expired":
+		return now - hour - validity, now - hour, nil
+	case "not_yet_valid":
+		return now + 24*hour, now + 24*hour + validity, nil
+	}
+	return 0, 0, fmt.Errorf("invalid signatures: %s", dnssec.Signatures)
+}
+
+// corruptSignature flips the bits of the first byte of the signature, so it no longer matches the RRset.
+func corruptSignature(rrsig *dns.RRSIG) error {
+	signature, err := base64.StdEncoding.DecodeString(rrsig.Signature)
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("failed to decode signature of %s: %v", rrsig.Hdr.Name, err)
+	}
+	signature[0] ^= 0xFF
+	rrsig.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// groupRRsets groups records by name, class and type, in the order they first appear.
+// Existing RRSIGs are left out, they're never signed themselves.
+func groupRRsets(rrs []dns.RR) [][]dns.RR {
+	var rrsets [][]dns.RR
+	index := make(map[string]int)
+
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeRRSIG {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d/%d", dns.CanonicalName(hdr.Name), hdr.Class, hdr.Rrtype)
+		i, ok := index[key]
+		if !ok {
+			i = len(rrsets)
+			index[key] = i
+			rrsets = append(rrsets, nil)
+		}
+		rrsets[i] = append(rrsets[i], rr)
+	}
+
+	return rrsets
+}
+
+// buildDenial creates the NSEC or NSEC3 record for the question name. Its type bitmap
+// lists the types of the answer records at that name, along with RRSIG and NSEC.
+func buildDenial(dnssec *models.DNSSEC, zone string, qname string, answers []dns.RR) (dns.RR, error) {
+	next := dnssec.NextName
+	if next == "" {
+		// The name that comes right after qname in canonical order (NSEC3 orders by hash instead, see below)
+		next = `\000.` + qname
+	}
+	next = dns.Fqdn(next)
+
+	var types []uint16
+	seen := make(map[uint16]bool)
+	for _, rr := range answers {
+		hdr := rr.Header()
+		if strings.EqualFold(hdr.Name, qname) && !seen[hdr.Rrtype] {
+			seen[hdr.Rrtype] = true
+			types = append(types, hdr.Rrtype)
+		}
+	}
+	types = append(types, dns.TypeRRSIG)
+
+	switch dnssec.Denial {
+	case "nsec":
+		types = append(types, dns.TypeNSEC)
+		slices.Sort(types)
+		return &dns.NSEC{
+			Hdr: dns.RR_Header{
+				Name:   qname,
+				Rrtype: dns.TypeNSEC,
+				Class:  dns.ClassINET,
+				Ttl:    dnssecTTL,
+			},
+			NextDomain: next,
+			TypeBitMap: types,
+		}, nil
+
+	case "nsec3":
+		slices.Sort(types)
+		salt := strings.ToUpper(dnssec.NSEC3Salt)
+		hashed := dns.HashName(qname, dns.SHA1, dnssec.NSEC3Iterations, salt)
+		if hashed == "" {
+			return nil, fmt.Errorf("failed to hash names for NSEC3")
+		}
+
+		// NSEC3 records are ordered by hash, so by default the next hashed owner is the one
+		// right after ours, no name that has to be hashed to get there
+		var nextHashed string
+		if dnssec.NextName != "" {
+			nextHashed = dns.HashName(next, dns.SHA1, dnssec.NSEC3Iterations, salt)
+		} else {
+			nextHashed = nextHash(hashed)
+		}
+		if nextHashed == "" {
+			return nil, fmt.Errorf("failed to hash names for NSEC3")
+		}
+
+		return &dns.NSEC3{
+			Hdr: dns.RR_Header{
+				Name:   hashed + "." + zone,
+				Rrtype: dns.TypeNSEC3,
+				Class:  dns.ClassINET,
+				Ttl:    dnssecTTL,
+			},
+			Hash:       dns.SHA1,
+			Iterations: dnssec.NSEC3Iterations,
+			SaltLength: uint8(len(salt) / 2),
+			Salt:       salt,
+			HashLength: uint8(len(nextHashed) * 5 / 8),
+			NextDomain: nextHashed,
+			TypeBitMap: types,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid denial: %s", dnssec.Denial)
+}
+
+// nextHash returns the NSEC3 hash (base32hex, as miekg writes them) that comes right after
+// the given one: the hash plus one, wrapping around to all zeros after the last one.
+// It returns "" if the hash isn't valid base32hex.
+func nextHash(hashed string) string {
+	encoding := base32.HexEncoding.WithPadding(base32.NoPadding)
+	hash, err := encoding.DecodeString(hashed)
+	if err != nil {
+		return ""
+	}
+
+	for i := len(hash) - 1; i >= 0; i-- {
+		hash[i]++
+		if hash[i] != 0 {
+			break
+		}
+	}
+	return encoding.EncodeToString(hash)
+}
@@ -0,0 +1,107 @@
+package crafter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"net"
+)
+
+// buildOPT translates the EDNS config into a dns.OPT pseudo-record.
+// Note that the extended RCODE is not set here, since miekg overwrites it
+// from msg.Rcode when packing, see BuildDNSRequest.
+func buildOPT(edns models.EDNS) (*dns.OPT, error) {
+	opt := &dns.OPT{
+		Hdr: dns.RR_Header{
+			Name:   ".",
+			Rrtype: dns.TypeOPT,
+		},
+	}
+
+	opt.SetUDPSize(edns.UDPSize)
+	opt.SetVersion(edns.Version)
+	opt.SetDo(edns.DO)
+
+	// The 15 bits after DO, we don't use SetZ() since it only covers 14 of them
+	opt.Hdr.Ttl = opt.Hdr.Ttl&^0x7FFF | uint32(edns.Z&0x7FFF)
+
+	for i, option := range edns.Options {
+		o, err := buildEDNSOption(option)
+		if err != nil {
+			return nil, fmt.Errorf("edns option %d: %w", i, err)
+		}
+		opt.Option = append(opt.Option, o)
+	}
+
+	return opt, nil
+}
+
+// buildEDNSOption translates a single EDNS option.
+// Options without dedicated fields are crafted from their raw hex payload.
+func buildEDNSOption(option models.EDNSOption) (dns.EDNS0, error) {
+	var code uint16
+	if option.Type == "CUSTOM" {
+		code = option.Code
+	} else {
+		var ok bool
+		code, ok = models.EDNSOptionMap[option.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid option type: %s", option.Type)
+		}
+	}
+
+	// Options with dedicated fields, a CUSTOM option always uses the raw payload
+	if option.Type != "CUSTOM" {
+		switch code {
+		case dns.EDNS0SUBNET:
+			return buildSubnetOption(option)
+
+		case dns.EDNS0COOKIE:
+			if _, err := hex.DecodeString(option.Cookie); err != nil {
+				return nil, fmt.Errorf("cookie is not valid hex: %w", err)
+			}
+			return &dns.EDNS0_COOKIE{Code: code, Cookie: option.Cookie}, nil
+
+		case dns.EDNS0PADDING:
+			return &dns.EDNS0_PADDING{Padding: make([]byte, option.Length)}, nil
+		}
+	}
+
+	// Everything else (including NSID) is simply the option code followed by the payload
+	data, err := hex.DecodeString(option.Data)
+	if err != nil {
+		return nil, fmt.Errorf("data is not valid hex: %w", err)
+	}
+
+	return &dns.EDNS0_LOCAL{Code: code, Data: data}, nil
+}
+
+// buildSubnetOption creates an EDNS Client Subnet option (RFC 7871).
+func buildSubnetOption(option models.EDNSOption) (dns.EDNS0, error) {
+	ip := net.ParseIP(option.Address)
+	if ip == nil {
+		return nil, fmt.Errorf("address is not a valid IP address: %s", option.Address)
+	}
+
+	// derive the family from the address if it's not set
+	family := option.Family
+	if family == 0 {
+		family = 2
+		if ip.To4() != nil {
+			family = 1
+		}
+	}
+
+	if family == 1 && ip.To4() != nil {
+		ip = ip.To4()
+	}
+
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: option.SourceNetmask,
+		SourceScope:   option.SourceScope,
+		Address:       ip,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package crafter
+
+import (
+	"github.com/faanross/spinnekop/internal/models"
+	"math/rand"
+	"time"
+)
+
+// IDSequence hands out the IDs for a series of messages, following Header.IDStrategy.
+type IDSequence struct {
+	header models.Header
+	rng    *rand.Rand
+	next   int
+}
+
+// NewIDSequence creates the ID sequence for the given header. Without an IDStrategy,
+// every ID is Header.ID, or a random one (seeded from the clock) if that's 0.
+func NewIDSequence(header models.Header) *IDSequence {
+	seed := time.Now().UnixNano()
+	if strategy := header.IDStrategy; strategy != nil && strategy.Seed != nil {
+		seed = *strategy.Seed
+	}
+
+	return &IDSequence{
+		header: header,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// PositionalIDs reports whether the IDs of the header's strategy depend on the position of the
+// message in the series: increment, list and seeded random. The others are the same (or just
+// as random) for every message.
+func PositionalIDs(header models.Header) bool {
+	strategy := header.IDStrategy
+	if strategy == nil {
+		return false
+	}
+
+	switch strategy.Mode {
+	case "increment", "list":
+		return true
+	case "constant":
+		return false
+	}
+	return strategy.Seed != nil
+}
+
+// At returns the ID of message n of the series (counting from 0) and moves on to the one after
+// it, so a series can pick up where an earlier one (e.g. an earlier run of the agent) left off.
+// Random IDs are drawn for the messages in between, so a seeded series gives the same IDs however
+// it's split up. If the sequence is already past message n, it's the same as Next.
+func (s *IDSequence) At(n int) uint16 {
+	for s.next < n {
+		s.Next()
+	}
+	return s.Next()
+}
+
+// Next returns the ID of the next message in the series.
+func (s *IDSequence) Next() uint16 {
+	n := s.next
+	s.next++
+
+	strategy := s.header.IDStrategy
+	if strategy == nil {
+		if s.header.ID == 0 {
+			return uint16(s.rng.Intn(65536))
+		}
+		return s.header.ID
+	}
+
+	switch strategy.Mode {
+	case "increment":
+		step := strategy.Step
+		if step == 0 {
+			step = 1
+		}
+		// uint16 arithmetic wraps around at 65535 for us
+		return strategy.Start + uint16(n)*step
+
+	case "list":
+		if len(strategy.List) == 0 {
+			return s.header.ID
+		}
+		return strategy.List[n%len(strategy.List)]
+
+	case "constant":
+		return s.header.ID
+	}
+
+	// random
+	return uint16(s.rng.Intn(65536))
+}
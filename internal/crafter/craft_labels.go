@@ -0,0 +1,133 @@
+package crafter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"github.com/miekg/dns"
+	"sort"
+)
+
+// packName returns the name miekg should pack. Names given as labels are packed
+// as the root (a single zero byte) and replaced by ApplyLabels afterwards,
+// since miekg would reject or normalize most of what labels allow for.
+func packName(name string, labels []models.Label) string {
+	if len(labels) > 0 {
+		return "."
+	}
+	return dns.Fqdn(name)
+}
+
+// EncodeLabels converts labels into their wire format: every label prefixed by its
+// length byte, followed by the root label. Since the length is a single byte a
+// label can't be longer than 255 bytes, everything else is allowed.
+func EncodeLabels(labels []models.Label) ([]byte, error) {
+	var encoded []byte
+
+	for i, label := range labels {
+		data := []byte(label.Text)
+		if label.Hex != "" {
+			var err error
+			data, err = hex.DecodeString(label.Hex)
+			if err != nil {
+				return nil, fmt.Errorf("label %d is not valid hex: %w", i, err)
+			}
+		}
+
+		if len(data) > 255 {
+			return nil, fmt.Errorf("label %d is %d bytes, but its length has to fit in a single byte (max 255)", i, len(data))
+		}
+
+		encoded = append(encoded, byte(len(data)))
+		encoded = append(encoded, data...)
+	}
+
+	return append(encoded, 0), nil
+}
+
+// ApplyLabels writes the names given as labels into a packed DNS message, in place of
+// the root placeholders packed by miekg. Since the message grows, a new byte slice is returned.
+func ApplyLabels(packedMsg []byte, req models.DNSRequest) ([]byte, error) {
+	type splice struct {
+		ref    string
+		labels []models.Label
+	}
+
+	var splices []splice
+	for i, question := range req.AllQuestions() {
+		splices = append(splices, splice{fmt.Sprintf("question[%d]", i), question.Labels})
+	}
+
+	// A single answer can be packed into more than one record (e.g. TXT data spread
+	// over several records), so we count the records as they are on the wire
+	addSection := func(section string, records []models.Answer) {
+		index := 0
+		for _, record := range records {
+			for n := 0; n < recordCount(record); n++ {
+				splices = append(splices, splice{fmt.Sprintf("%s[%d]", section, index), record.Labels})
+				index++
+			}
+		}
+	}
+
+	// Answers are only packed for responses and NOTIFY queries (see PacksAnswers)
+	if PacksAnswers(req.Header) {
+		addSection("answer", req.Answers)
+	}
+	addSection("authority", req.Authority)
+	addSection("additional", req.Additional)
+
+	// We find all the names up front, since the labels we write may be
+	// impossible to walk past (e.g. a length byte over 63 looks like a different label type)
+	layout, err := wire.Walk(packedMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	type placement struct {
+		offset  int
+		encoded []byte
+	}
+
+	var placements []placement
+	for _, s := range splices {
+		if len(s.labels) == 0 {
+			continue
+		}
+
+		offset, err := layout.NameOffset(s.ref)
+		if err != nil {
+			return nil, err
+		}
+		if packedMsg[offset] != 0 {
+			return nil, fmt.Errorf("%s: expected the root placeholder at offset %d", s.ref, offset)
+		}
+
+		encoded, err := EncodeLabels(s.labels)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.ref, err)
+		}
+
+		placements = append(placements, placement{offset, encoded})
+	}
+
+	// Working from the back of the message to the front keeps the earlier offsets valid
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i].offset > placements[j].offset
+	})
+
+	msg := append([]byte(nil), packedMsg...)
+	for _, p := range placements {
+		// Skip the single zero byte of the placeholder root name
+		rest := msg[p.offset+1:]
+
+		spliced := make([]byte, 0, len(msg)+len(p.encoded))
+		spliced = append(spliced, msg[:p.offset]...)
+		spliced = append(spliced, p.encoded...)
+		spliced = append(spliced, rest...)
+		msg = spliced
+	}
+
+	return msg, nil
+}
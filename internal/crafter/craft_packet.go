@@ -0,0 +1,56 @@
+package crafter
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+)
+
+// Craft runs the same steps as the agent to turn a config into the final packet: building
+// and packing the dns.Msg, then writing the labels and pointers, holding it to the size
+// policy, and writing the overrides, TSIG and patches.
+// It returns the packet, the dns.Msg it was packed from, the offsets of the patched bytes
+// and how the final packet measures up to the size limit.
+func Craft(req models.DNSRequest) ([]byte, *dns.Msg, []int, SizeReport, error) {
+	dnsMsg, err := BuildDNSRequest(req)
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to build DNS request: %w", err)
+	}
+
+	packedMsg, err := dnsMsg.Pack()
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to pack message: %w", err)
+	}
+
+	packedMsg, err = ApplyLabels(packedMsg, req)
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to apply labels: %w", err)
+	}
+
+	packedMsg, err = ApplyPointers(packedMsg, req.Compression)
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to apply compression pointers: %w", err)
+	}
+
+	packedMsg, sizeReport, err := ApplySizePolicy(packedMsg, req)
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to apply size policy: %w", err)
+	}
+
+	if err := ApplyManualOverride(packedMsg, req.Header); err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to apply manual overrides: %w", err)
+	}
+
+	packedMsg, err = ApplyTSIG(packedMsg, req.TSIG)
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	packedMsg, patched, err := ApplyPatches(packedMsg, req.Patches)
+	if err != nil {
+		return nil, nil, nil, SizeReport{}, fmt.Errorf("failed to apply patches: %w", err)
+	}
+
+	sizeReport.Final = len(packedMsg)
+	return packedMsg, dnsMsg, patched, sizeReport, nil
+}
@@ -0,0 +1,103 @@
+package crafter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+)
+
+// ApplyPatches applies the patches from the config to a packed DNS message, in order.
+// Since this happens after all other overrides, patches always have the final say.
+// It returns the patched message (appending makes it grow) and the offsets of
+// every byte that was patched, so they can be highlighted.
+func ApplyPatches(packedMsg []byte, patches []models.Patch) ([]byte, []int, error) {
+	msg := packedMsg
+	var patched []int
+
+	for i, patch := range patches {
+		// Appending doesn't need a position, the bytes always go at the end
+		if patch.Append != "" {
+			data, err := hex.DecodeString(patch.Append)
+			if err != nil {
+				return nil, nil, fmt.Errorf("patch %d: append is not valid hex: %w", i, err)
+			}
+			for j := range data {
+				patched = append(patched, len(msg)+j)
+			}
+			msg = append(msg, data...)
+			continue
+		}
+
+		offset, err := patchOffset(msg, patch)
+		if err != nil {
+			return nil, nil, fmt.Errorf("patch %d: %w", i, err)
+		}
+
+		if patch.Bytes != "" {
+			data, err := hex.DecodeString(patch.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("patch %d: bytes is not valid hex: %w", i, err)
+			}
+			if offset+len(data) > len(msg) {
+				return nil, nil, fmt.Errorf("patch %d: %d byte(s) at offset %d run past the end of the message (%d bytes), use append to add bytes", i, len(data), offset, len(msg))
+			}
+			for j, b := range data {
+				msg[offset+j] = b
+				patched = append(patched, offset+j)
+			}
+			continue
+		}
+
+		mask, err := hex.DecodeString(patch.Mask)
+		if err != nil {
+			return nil, nil, fmt.Errorf("patch %d: mask is not valid hex: %w", i, err)
+		}
+		value, err := hex.DecodeString(patch.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("patch %d: value is not valid hex: %w", i, err)
+		}
+		if len(mask) == 0 || len(mask) != len(value) {
+			return nil, nil, fmt.Errorf("patch %d: needs bytes, append, or a mask and value of the same length", i)
+		}
+		if offset+len(mask) > len(msg) {
+			return nil, nil, fmt.Errorf("patch %d: %d byte(s) at offset %d run past the end of the message (%d bytes)", i, len(mask), offset, len(msg))
+		}
+
+		// Clear the bits selected by the mask, then set them to those of the value
+		for j := range mask {
+			msg[offset+j] = msg[offset+j]&^mask[j] | value[j]&mask[j]
+			patched = append(patched, offset+j)
+		}
+	}
+
+	return msg, patched, nil
+}
+
+// patchOffset works out where a patch starts, from its anchor and/or offset.
+// Anchors are looked up in the message as it is at that point, so they follow
+// earlier patches as well as the header counts, just like a parser would.
+func patchOffset(msg []byte, patch models.Patch) (int, error) {
+	var offset int
+	if patch.Offset != nil {
+		offset = int(*patch.Offset)
+	}
+
+	if patch.Anchor == "" {
+		if patch.Offset == nil {
+			return 0, fmt.Errorf("needs an anchor or an offset")
+		}
+		return offset, nil
+	}
+
+	layout, err := wire.Walk(msg)
+	if err != nil {
+		return 0, err
+	}
+	anchorOffset, _, err := layout.Anchor(patch.Anchor)
+	if err != nil {
+		return 0, err
+	}
+
+	return anchorOffset + offset, nil
+}
@@ -0,0 +1,124 @@
+package crafter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+)
+
+// maxPointerOffset is the largest offset a 14-bit compression pointer can hold.
+const maxPointerOffset = 0x3FFF
+
+// ApplyPointers writes the compression pointers from the config into a packed DNS message.
+// miekg only ever writes valid pointers (and only when compressing), so we splice them in
+// ourselves: the labels of the name after KeepLabels are cut and replaced by a 2-byte pointer.
+// Since the message changes size, a new byte slice is returned.
+func ApplyPointers(packedMsg []byte, compression *models.Compression) ([]byte, error) {
+	if compression == nil {
+		return packedMsg, nil
+	}
+
+	msg := packedMsg
+	for i, injection := range compression.Pointers {
+		var err error
+		msg, err = applyPointer(msg, injection)
+		if err != nil {
+			return nil, fmt.Errorf("pointer %d (%s): %w", i, injection.Name, err)
+		}
+	}
+
+	return msg, nil
+}
+
+// applyPointer splices a single compression pointer into the message.
+func applyPointer(msg []byte, injection models.PointerInjection) ([]byte, error) {
+	layout, err := wire.Walk(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	nameOffset, err := layout.NameOffset(injection.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pointer starts right after the labels we keep, and replaces everything up to the end of the name
+	pointerOffset, err := wire.SkipLabels(msg, nameOffset, injection.KeepLabels)
+	if err != nil {
+		return nil, err
+	}
+	nameEnd, err := wire.SkipName(msg, pointerOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	// We splice first, using a placeholder pointer, so the target can be
+	// looked up in the message as it is once the name has shrunk (or grown)
+	spliced := make([]byte, 0, len(msg)+2)
+	spliced = append(spliced, msg[:pointerOffset]...)
+	spliced = append(spliced, 0xC0, 0x00)
+	spliced = append(spliced, msg[nameEnd:]...)
+
+	target, err := pointerTarget(spliced, pointerOffset, injection)
+	if err != nil {
+		return nil, err
+	}
+	if target > maxPointerOffset {
+		return nil, fmt.Errorf("target offset %d does not fit in a pointer (max %d)", target, maxPointerOffset)
+	}
+
+	binary.BigEndian.PutUint16(spliced[pointerOffset:pointerOffset+2], 0xC000|uint16(target))
+
+	return spliced, nil
+}
+
+// pointerTarget works out the offset the pointer at pointerOffset should point to.
+func pointerTarget(msg []byte, pointerOffset int, injection models.PointerInjection) (int, error) {
+	switch injection.Kind {
+	case "loop":
+		return pointerOffset, nil
+
+	case "header":
+		if injection.Offset >= wire.HeaderLength {
+			return 0, fmt.Errorf("header offset must be between 0 and %d, but got %d", wire.HeaderLength-1, injection.Offset)
+		}
+		return int(injection.Offset), nil
+
+	case "offset":
+		return int(injection.Offset), nil
+	}
+
+	layout, err := wire.Walk(msg)
+	if err != nil {
+		return 0, err
+	}
+	targetOffset, err := layout.NameOffset(injection.Target)
+	if err != nil {
+		return 0, fmt.Errorf("target: %w", err)
+	}
+
+	switch injection.Kind {
+	case "name":
+		return targetOffset, nil
+
+	case "forward":
+		if targetOffset <= pointerOffset {
+			return 0, fmt.Errorf("target %s does not come after the pointer", injection.Target)
+		}
+		return targetOffset, nil
+
+	case "mid_label":
+		// The first byte of the label is its length, so offsets 1 up to the length are inside it
+		labelLength := int(msg[targetOffset])
+		if labelLength&0xC0 != 0 || labelLength == 0 {
+			return 0, fmt.Errorf("target %s does not start with a label", injection.Target)
+		}
+		if injection.Offset < 1 || int(injection.Offset) > labelLength {
+			return 0, fmt.Errorf("mid_label offset must be between 1 and %d for target %s, but got %d", labelLength, injection.Target, injection.Offset)
+		}
+		return targetOffset + int(injection.Offset), nil
+	}
+
+	return 0, fmt.Errorf("invalid pointer kind: %s", injection.Kind)
+}
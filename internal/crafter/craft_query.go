@@ -0,0 +1,37 @@
+package crafter
+
+import (
+	"github.com/faanross/spinnekop/internal/models"
+)
+
+// MatchingQuery returns the config of the query a response answers, so the two form a
+// complete exchange. It has the given ID (the one the response ended up with, whatever
+// its ID strategy picked or patches wrote), and the response's opcode, questions (or
+// update) and EDNS, with RD and CD as the response echoes them. It's never signed.
+func MatchingQuery(resp models.DNSRequest, id uint16) models.DNSRequest {
+	query := models.DNSRequest{
+		Header: models.Header{
+			ID:               id,
+			IDStrategy:       &models.IDStrategy{Mode: "constant"},
+			OpCode:           resp.Header.OpCode,
+			StdOpCode:        resp.Header.StdOpCode,
+			CustomOpCode:     resp.Header.CustomOpCode,
+			RecursionDesired: resp.Header.RecursionDesired,
+			CheckingDisabled: resp.Header.CheckingDisabled,
+		},
+		Question:        resp.Question,
+		Questions:       resp.Questions,
+		Resolver:        resp.Resolver,
+		Update:          resp.Update,
+		AllowViolations: resp.AllowViolations,
+	}
+
+	// The extended RCODE is only set in responses
+	if resp.EDNS != nil {
+		edns := *resp.EDNS
+		edns.ExtendedRCode = 0
+		query.EDNS = &edns
+	}
+
+	return query
+}
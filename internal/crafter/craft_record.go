@@ -0,0 +1,248 @@
+package crafter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// buildRecord translates a single models.Answer into a dns.RR.
+// Structured RDATA (answer.RData) is used if present, otherwise answer.Data
+// is interpreted based on the record type.
+func buildRecord(answer models.Answer) (dns.RR, error) {
+	// Raw records bypass the type map and are written byte-for-byte
+	if answer.TypeCode != 0 || answer.RawRData != "" {
+		return buildRawRecord(answer)
+	}
+
+	rrType, ok := models.QTypeMap[answer.Type]
+	if !ok {
+		return nil, fmt.Errorf("invalid record type: %s", answer.Type)
+	}
+
+	class, err := recordClass(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := dns.RR_Header{
+		Name:   packName(answer.Name, answer.Labels),
+		Rrtype: rrType,
+		Class:  class,
+		Ttl:    answer.TTL,
+	}
+
+	if answer.RData != nil {
+		return buildStructuredRecord(hdr, answer)
+	}
+
+	// TXT data is taken as-is, without having to quote it,
+	// but cut into strings that fit (see buildRecords for more than one record)
+	if rrType == dns.TypeTXT {
+		return &dns.TXT{Hdr: hdr, Txt: chunkTXT(answer.Data, maxTXTString)}, nil
+	}
+
+	return parsePresentation(hdr, answer.Type, answer.Data)
+}
+
+// buildStructuredRecord creates the dns.RR from the structured RDATA fields.
+func buildStructuredRecord(hdr dns.RR_Header, answer models.Answer) (dns.RR, error) {
+	rdata := answer.RData
+
+	switch hdr.Rrtype {
+	case dns.TypeA:
+		ip := net.ParseIP(rdata.Address).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("rdata.address is not a valid IPv4 address: %s", rdata.Address)
+		}
+		return &dns.A{Hdr: hdr, A: ip}, nil
+
+	case dns.TypeAAAA:
+		ip := net.ParseIP(rdata.Address)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("rdata.address is not a valid IPv6 address: %s", rdata.Address)
+		}
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+
+	case dns.TypeCNAME:
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(rdata.Target)}, nil
+
+	case dns.TypeNS:
+		return &dns.NS{Hdr: hdr, Ns: dns.Fqdn(rdata.Target)}, nil
+
+	case dns.TypePTR:
+		return &dns.PTR{Hdr: hdr, Ptr: dns.Fqdn(rdata.Target)}, nil
+
+	case dns.TypeMX:
+		return &dns.MX{Hdr: hdr, Preference: rdata.Preference, Mx: dns.Fqdn(rdata.Target)}, nil
+
+	case dns.TypeSRV:
+		return &dns.SRV{
+			Hdr:      hdr,
+			Priority: rdata.Priority,
+			Weight:   rdata.Weight,
+			Port:     rdata.Port,
+			Target:   dns.Fqdn(rdata.Target),
+		}, nil
+
+	case dns.TypeSOA:
+		return &dns.SOA{
+			Hdr:     hdr,
+			Ns:      dns.Fqdn(rdata.MName),
+			Mbox:    dns.Fqdn(rdata.RName),
+			Serial:  rdata.Serial,
+			Refresh: rdata.Refresh,
+			Retry:   rdata.Retry,
+			Expire:  rdata.Expire,
+			Minttl:  rdata.Minimum,
+		}, nil
+
+	case dns.TypeCAA:
+		return &dns.CAA{Hdr: hdr, Flag: rdata.Flag, Tag: rdata.Tag, Value: rdata.Value}, nil
+
+	case dns.TypeNULL:
+		data, err := hex.DecodeString(rdata.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("rdata.hex is not valid hex: %w", err)
+		}
+		return &dns.NULL{Hdr: hdr, Data: string(data)}, nil
+
+	case dns.TypeHTTPS:
+		// SvcParams have many sub-formats, so we let miekg parse them for us
+		presentation := fmt.Sprintf("%d %s %s", rdata.Priority, dns.Fqdn(rdata.Target), rdata.Params)
+		return parsePresentation(hdr, answer.Type, presentation)
+	}
+
+	return nil, fmt.Errorf("structured rdata is not supported for type %s, use data instead", answer.Type)
+}
+
+// parsePresentation creates a dns.RR from RDATA in zone-file presentation format.
+// We build a complete zone-file line and let miekg's parser do the heavy lifting,
+// this way every type miekg knows about is supported.
+func parsePresentation(hdr dns.RR_Header, rrType string, rdata string) (dns.RR, error) {
+	if rdata == "" {
+		return nil, fmt.Errorf("data must contain the RDATA for type %s", rrType)
+	}
+
+	line := fmt.Sprintf("%s %d IN %s %s", hdr.Name, hdr.Ttl, rrType, rdata)
+	rr, err := dns.NewRR(line)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse data for type %s: %w", rrType, err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("data must contain the RDATA for type %s", rrType)
+	}
+
+	rr.Header().Class = hdr.Class
+
+	return rr, nil
+}
+
+// buildRawRecord creates a dns.RFC3597 record, which miekg packs without
+// looking at the RDATA. This works for known and unknown types alike.
+func buildRawRecord(answer models.Answer) (dns.RR, error) {
+	rrType := answer.TypeCode
+	if rrType == 0 {
+		var ok bool
+		rrType, ok = models.QTypeMap[answer.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid record type: %s", answer.Type)
+		}
+	}
+
+	class, err := recordClass(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	rdata, err := ParseRawRData(answer.RawRData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dns.RFC3597{
+		Hdr: dns.RR_Header{
+			Name:   packName(answer.Name, answer.Labels),
+			Rrtype: rrType,
+			Class:  class,
+			Ttl:    answer.TTL,
+		},
+		Rdata: hex.EncodeToString(rdata),
+	}, nil
+}
+
+// recordClass works out the CLASS field of a record, following the same
+// std_class/custom_class rules as buildQuestion, plus the mDNS cache-flush bit.
+func recordClass(answer models.Answer) (uint16, error) {
+	// special condition for class since we allow for standard and non-standard values
+	var class uint16
+	if answer.UsesStdClass() {
+		// Standard class mode - look up in map (or the generic CLASSnnn form)
+		var err error
+		class, err = ParseGenericClass(answer.Class)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		// Custom class mode - use the raw value
+		class = answer.CustomClass
+	}
+
+	// The cache-flush flag is the top bit of the 16-bit CLASS field
+	if answer.CacheFlush {
+		class |= 0x8000
+	}
+
+	return class, nil
+}
+
+// ParseRawRData decodes RDATA given in RFC 3597 generic encoding: `\# <length> <hex>`.
+// The hex data may be split by whitespace, and the length has to match the data.
+func ParseRawRData(raw string) ([]byte, error) {
+	fields := strings.Fields(raw)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, fmt.Errorf("raw_rdata must be in the form \\# <length> <hex>, but got %q", raw)
+	}
+
+	length, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("raw_rdata length is not a valid number between 0 and 65535: %s", fields[1])
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("raw_rdata is not valid hex: %w", err)
+	}
+
+	if int(length) != len(data) {
+		return nil, fmt.Errorf("raw_rdata length is %d, but the data is %d bytes", length, len(data))
+	}
+
+	return data, nil
+}
+
+// ParseGenericClass converts a class name from QClassMap, or a class in
+// RFC 3597 generic form (e.g. "CLASS300"), into its numeric value.
+// An empty class defaults to IN.
+func ParseGenericClass(class string) (uint16, error) {
+	if class == "" {
+		return dns.ClassINET, nil
+	}
+
+	if value, ok := models.QClassMap[class]; ok {
+		return value, nil
+	}
+
+	if strings.HasPrefix(class, "CLASS") {
+		value, err := strconv.ParseUint(strings.TrimPrefix(class, "CLASS"), 10, 16)
+		if err == nil {
+			return uint16(value), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid class: %s", class)
+}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"github.com/faanross/spinnekop/internal/models"
 	"github.com/miekg/dns"
-	"math/rand"
-	"time"
 )
 
 // BuildDNSRequest takes the parsed request data and translates it into a dns.Msg object.
@@ -15,41 +13,24 @@ func BuildDNSRequest(req models.DNSRequest) (*dns.Msg, error) {
 	msg := new(dns.Msg)
 
 	// Header.ID is taken from YAML, OR, if set to 0, we'll generate it randomly
+	// Header.IDStrategy can change this, we use the first ID of its sequence
+	msg.Id = NewIDSequence(req.Header).Next()
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// For the opcode (and the question type and class, see buildQuestion) we first
+	// want to use our maps in package models to convert their struct field values
+	// to those found in miekg package
 
-	if req.Header.ID == 0 {
-		msg.Id = uint16(r.Intn(65536))
-	} else {
-		msg.Id = req.Header.ID
-	}
-
-	// For the following 3 fields we first want to use our maps in package models
-	// To convert their struct field values to those found in miekg package
-
-	opCode, ok := models.OpCodeMap[req.Header.OpCode]
-	if !ok {
-		return nil, fmt.Errorf("invalid opcode: %s", req.Header.OpCode)
-	}
-	msg.Opcode = opCode
-
-	qType, ok := models.QTypeMap[req.Question.Type]
-	if !ok {
-		return nil, fmt.Errorf("invalid question type: %s", req.Question.Type)
-	}
-
-	// special condition for qClass since we allow for standard and non-standard values
-	var qClass uint16
-	if req.Question.StdClass {
-		// Standard class mode - look up in map
-		var ok bool
-		qClass, ok = models.QClassMap[req.Question.Class]
+	// special condition for opCode since we allow for standard and non-standard values
+	if req.Header.UsesStdOpCode() {
+		// Standard opcode mode - look up in map
+		opCode, ok := models.OpCodeMap[req.Header.OpCode]
 		if !ok {
-			return nil, fmt.Errorf("invalid question class: %s", req.Question.Class)
+			return nil, fmt.Errorf("invalid opcode: %s", req.Header.OpCode)
 		}
+		msg.Opcode = opCode
 	} else {
-		// Custom class mode - use the raw value
-		qClass = req.Question.CustomClass
+		// Custom opcode mode - use the raw value
+		msg.Opcode = int(req.Header.CustomOpCode)
 	}
 
 	// For all the remaining fields we can directly use the struct field values
@@ -60,41 +41,149 @@ func BuildDNSRequest(req models.DNSRequest) (*dns.Msg, error) {
 	msg.Truncated = req.Header.Truncated
 	msg.RecursionDesired = req.Header.RecursionDesired
 	msg.RecursionAvailable = req.Header.RecursionAvailable
+	msg.AuthenticatedData = req.Header.AuthenticatedData
+	msg.CheckingDisabled = req.Header.CheckingDisabled
 
 	msg.Rcode = int(req.Header.RCode)
 
 	// Reminder: Z-Value cannot be created using miekg/dns,
 	// We'll do it manually using ApplyManualOverrides()
 
-	// Manually create the Question struct and append it to the message.
+	// Manually create the Question structs and append them to the message.
 	// This gives us full control and avoids the problematic SetQuestion helper.
-	msg.Question = []dns.Question{
-		{
-			Name:   dns.Fqdn(req.Question.Name),
-			Qtype:  qType,
-			Qclass: qClass,
-		},
+	// Note that we allow for more than one question (QDCOUNT > 1).
+	// An update has a zone section instead, which takes the place of the question.
+	if req.Update != nil {
+		zone, err := buildZone(*req.Update)
+		if err != nil {
+			return nil, fmt.Errorf("update: %w", err)
+		}
+		msg.Question = []dns.Question{zone}
+	} else {
+		for i, question := range req.AllQuestions() {
+			q, err := buildQuestion(question)
+			if err != nil {
+				return nil, fmt.Errorf("question %d: %w", i, err)
+			}
+			msg.Question = append(msg.Question, q)
+		}
 	}
 
-	// Add answer records if this is a response
-	if req.Header.QR {
-		for _, answer := range req.Answers {
-			switch answer.Type {
-			case "TXT":
-				rr := &dns.TXT{
-					Hdr: dns.RR_Header{
-						Name:   dns.Fqdn(answer.Name),
-						Rrtype: dns.TypeTXT,
-						Class:  dns.ClassINET,
-						Ttl:    answer.TTL,
-					},
-					Txt: []string{answer.Data},
-				}
-				msg.Answer = append(msg.Answer, rr)
-				// Add other record types as needed
-			}
+	// Add answer records if this is a response (or a NOTIFY, see PacksAnswers)
+	if PacksAnswers(req.Header) {
+		answers, err := buildSection("answer", req.Answers)
+		if err != nil {
+			return nil, err
 		}
+		msg.Answer = answers
+	}
+
+	// Authority and additional records are added for queries as well,
+	// since queries can legitimately carry them (e.g. the SOA of an IXFR)
+	authority, err := buildSection("authority", req.Authority)
+	if err != nil {
+		return nil, err
+	}
+	msg.Ns = authority
+
+	additional, err := buildSection("additional", req.Additional)
+	if err != nil {
+		return nil, err
+	}
+	msg.Extra = additional
+
+	// The prerequisites and operations of an update fill the answer and authority sections
+	if req.Update != nil {
+		if err := buildUpdate(msg, *req.Update); err != nil {
+			return nil, fmt.Errorf("update: %w", err)
+		}
+	}
+
+	// Sign the answer and authority records, adding the DNSSEC records the config asks for
+	if err := ApplyDNSSEC(msg, req.DNSSEC); err != nil {
+		return nil, fmt.Errorf("dnssec: %w", err)
+	}
+
+	// The OPT pseudo-record always comes after the additional records
+	if req.EDNS != nil {
+		opt, err := buildOPT(*req.EDNS)
+		if err != nil {
+			return nil, err
+		}
+		msg.Extra = append(msg.Extra, opt)
+
+		// miekg sets the OPT's extended RCODE from the upper bits of msg.Rcode
+		// when packing, so we have to pass it along as a 12-bit RCODE
+		msg.Rcode = int(req.EDNS.ExtendedRCode)<<4 | int(req.Header.RCode)
+	}
+
+	// miekg never compresses unless asked to, so "off" (or no compression block)
+	// writes every name in full, leaving room for the pointers in ApplyPointers
+	if req.Compression != nil && req.Compression.Mode == "on" {
+		msg.Compress = true
 	}
 
 	return msg, nil
 }
+
+// PacksAnswers reports whether the answer section is packed. That's the case for responses,
+// and for NOTIFY queries, which can carry the zone's new SOA as an answer (RFC 1996).
+func PacksAnswers(header models.Header) bool {
+	if header.QR {
+		return true
+	}
+	if header.UsesStdOpCode() {
+		return header.OpCode == "NOTIFY"
+	}
+	return header.CustomOpCode == dns.OpcodeNotify
+}
+
+// buildQuestion translates a single models.Question into a dns.Question.
+func buildQuestion(question models.Question) (dns.Question, error) {
+	// special condition for qType since we allow for standard and non-standard values
+	var qType uint16
+	if question.UsesStdType() {
+		// Standard type mode - look up in map
+		var ok bool
+		qType, ok = models.QTypeMap[question.Type]
+		if !ok {
+			return dns.Question{}, fmt.Errorf("invalid question type: %s", question.Type)
+		}
+	} else {
+		// Custom type mode - use the raw value
+		qType = question.CustomType
+	}
+
+	// special condition for qClass since we allow for standard and non-standard values
+	var qClass uint16
+	if question.UsesStdClass() {
+		// Standard class mode - look up in map
+		var ok bool
+		qClass, ok = models.QClassMap[question.Class]
+		if !ok {
+			return dns.Question{}, fmt.Errorf("invalid question class: %s", question.Class)
+		}
+	} else {
+		// Custom class mode - use the raw value
+		qClass = question.CustomClass
+	}
+
+	return dns.Question{
+		Name:   packName(question.Name, question.Labels),
+		Qtype:  qType,
+		Qclass: qClass,
+	}, nil
+}
+
+// buildSection translates all the records of a single message section into dns.RRs.
+func buildSection(section string, records []models.Answer) ([]dns.RR, error) {
+	var rrs []dns.RR
+	for i, record := range records {
+		built, err := buildRecords(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %w", section, i, err)
+		}
+		rrs = append(rrs, built...)
+	}
+	return rrs, nil
+}
@@ -0,0 +1,152 @@
+package crafter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"github.com/miekg/dns"
+)
+
+const (
+	// classicUDPLimit is the largest message plain DNS over UDP allows (RFC 1035)
+	classicUDPLimit = 512
+
+	defaultSizePolicy = "warn"
+)
+
+// SizeReport tells how the message measures up to the limit of its size policy.
+type SizeReport struct {
+	Policy string
+	Limit  int
+
+	// Size: The size before the policy was applied, Final the size on the wire, which
+	// Craft fills in once the TSIG and patches are in place (ApplySizePolicy can't know it)
+	Size  int
+	Final int
+
+	// Applied: Whether the policy changed the message (records dropped, TC set)
+	Applied bool
+
+	// The number of records dropped from every section, and whether TC was set for it
+	DroppedAnswers    int
+	DroppedAuthority  int
+	DroppedAdditional int
+	Truncated         bool
+}
+
+// Over reports whether the final message is larger than the limit.
+func (r SizeReport) Over() bool {
+	return r.Final > r.Limit
+}
+
+// SizeLimit returns the size limit of the message: the one of its size policy, the largest
+// message the length prefix allows over TCP, the EDNS UDP payload size (values below 512
+// count as 512, RFC 6891) or the classic 512 bytes.
+func SizeLimit(req models.DNSRequest) int {
+	if req.Size != nil && req.Size.Limit > 0 {
+		return req.Size.Limit
+	}
+	if req.Resolver.Transport == "tcp" {
+		return dns.MaxMsgSize
+	}
+	if req.EDNS != nil {
+		return max(classicUDPLimit, int(req.EDNS.UDPSize))
+	}
+	return classicUDPLimit
+}
+
+// ApplySizePolicy holds the packed message against the size limit. Only the strict policy
+// changes it: like a real server, it keeps the header, the questions and the OPT record, and
+// drops records from the end until the message fits. TC is set if any answer or authority
+// records were dropped, but not for additional records only (RFC 2181, section 9).
+// It runs before the count overrides, TSIG and patches. Room is left for the TSIG record,
+// but not for patches, which get the final say over the size as well.
+func ApplySizePolicy(packedMsg []byte, req models.DNSRequest) ([]byte, SizeReport, error) {
+	report := SizeReport{
+		Policy: defaultSizePolicy,
+		Limit:  SizeLimit(req),
+		Size:   len(packedMsg),
+		Final:  len(packedMsg),
+	}
+	if req.Size != nil && req.Size.Policy != "" {
+		report.Policy = req.Size.Policy
+	}
+	if report.Policy != "strict" {
+		return packedMsg, report, nil
+	}
+
+	// The TSIG record is added after us, its length doesn't depend on the message
+	reserve := 0
+	if req.TSIG != nil {
+		signed, err := ApplyTSIG(packedMsg, req.TSIG)
+		if err != nil {
+			return nil, report, err
+		}
+		reserve = len(signed) - len(packedMsg)
+	}
+	if len(packedMsg)+reserve <= report.Limit {
+		return packedMsg, report, nil
+	}
+
+	layout, err := wire.Walk(packedMsg)
+	if err != nil {
+		return nil, report, err
+	}
+	if layout.Err != nil || layout.End != len(packedMsg) {
+		return nil, report, fmt.Errorf("can't find the records to drop: %v", layout.Err)
+	}
+
+	// The crafter always puts the OPT record last
+	additional := layout.Additional
+	var opt []byte
+	if n := len(additional); n > 0 && binary.BigEndian.Uint16(packedMsg[additional[n-1].TypeOffset:]) == dns.TypeOPT {
+		opt = packedMsg[additional[n-1].NameOffset:additional[n-1].End]
+		additional = additional[:n-1]
+	}
+
+	// Records are kept in the order they appear for as long as they fit, so the
+	// ones we keep are always one piece, from the questions up to the last one
+	keepEnd := wire.HeaderLength
+	if n := len(layout.Questions); n > 0 {
+		keepEnd = layout.Questions[n-1].End
+	}
+	sections := [][]wire.Record{layout.Answers, layout.Authority, additional}
+	kept := make([]int, len(sections))
+	full := false
+	for i, records := range sections {
+		for _, r := range records {
+			if full || r.End+len(opt)+reserve > report.Limit {
+				full = true
+				break
+			}
+			keepEnd = r.End
+			kept[i]++
+		}
+	}
+
+	report.Applied = true
+	report.DroppedAnswers = len(layout.Answers) - kept[0]
+	report.DroppedAuthority = len(layout.Authority) - kept[1]
+	report.DroppedAdditional = len(additional) - kept[2]
+	report.Truncated = report.DroppedAnswers > 0 || report.DroppedAuthority > 0
+
+	truncated := append(bytes.Clone(packedMsg[:keepEnd]), opt...)
+	arcount := kept[2]
+	if opt != nil {
+		arcount++
+	}
+	binary.BigEndian.PutUint16(truncated[6:8], uint16(kept[0]))
+	binary.BigEndian.PutUint16(truncated[8:10], uint16(kept[1]))
+	binary.BigEndian.PutUint16(truncated[10:12], uint16(arcount))
+
+	// TC is bit 9 of the flags (bytes 2 and 3 of the header)
+	if report.Truncated {
+		flags := binary.BigEndian.Uint16(truncated[2:4]) | 0x0200
+		binary.BigEndian.PutUint16(truncated[2:4], flags)
+	}
+
+	report.Final = len(truncated)
+	return truncated, report, nil
+}
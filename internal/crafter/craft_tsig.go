@@ -0,0 +1,175 @@
+package crafter
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"github.com/miekg/dns"
+	"hash"
+	"time"
+)
+
+// defaultFudge is the fudge RFC 8945 recommends, in seconds.
+const defaultFudge = 300
+
+// maxTimeSigned is the largest time signed that fits in its 48 bits.
+const maxTimeSigned = 1<<48 - 1
+
+// ApplyTSIG signs a packed DNS message and appends the TSIG record to it. miekg can only
+// sign a dns.Msg it packs itself, so we sign the bytes as they are after all our
+// modifications: the MAC covers the message (with ARCOUNT as it was before the TSIG record
+// was added) followed by the TSIG variables (RFC 8945, section 4.3.3).
+func ApplyTSIG(packedMsg []byte, tsig *models.TSIG) ([]byte, error) {
+	if tsig == nil {
+		return packedMsg, nil
+	}
+	if len(packedMsg) < wire.HeaderLength {
+		return nil, fmt.Errorf("message is only %d bytes, too short for a header", len(packedMsg))
+	}
+
+	algorithm, ok := models.TSIGAlgorithmMap[tsig.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", tsig.Algorithm)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(tsig.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("secret is not valid base64: %w", err)
+	}
+
+	requestMAC, err := hex.DecodeString(tsig.RequestMAC)
+	if err != nil {
+		return nil, fmt.Errorf("request_mac is not valid hex: %w", err)
+	}
+
+	timeSigned, err := tsigTime(tsig)
+	if err != nil {
+		return nil, err
+	}
+
+	fudge := tsig.Fudge
+	if fudge == 0 {
+		fudge = defaultFudge
+	}
+
+	rr := &dns.TSIG{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(tsig.KeyName),
+			Rrtype: dns.TypeTSIG,
+			Class:  dns.ClassANY,
+		},
+		Algorithm:  algorithm,
+		TimeSigned: timeSigned,
+		Fudge:      fudge,
+		OrigId:     binary.BigEndian.Uint16(packedMsg[0:2]),
+	}
+
+	mac, err := tsigMAC(packedMsg, rr, requestMAC, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if tsig.BadMAC {
+		mac[0] ^= 0xFF
+	}
+
+	// The name in the record only changes once the MAC is calculated with the real one
+	if tsig.WrongKeyName != "" {
+		rr.Hdr.Name = dns.Fqdn(tsig.WrongKeyName)
+	}
+
+	rr.MACSize = uint16(len(mac))
+	rr.MAC = hex.EncodeToString(mac)
+
+	// Both names and the MAC are the only variable length fields
+	record := make([]byte, 2*maxNameLength+len(mac)+32)
+	n, err := dns.PackRR(rr, record, 0, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack TSIG record: %w", err)
+	}
+
+	signed := make([]byte, 0, len(packedMsg)+n)
+	signed = append(signed, packedMsg...)
+	signed = append(signed, record[:n]...)
+
+	// The TSIG record is one more additional record
+	arcount := binary.BigEndian.Uint16(signed[10:12])
+	binary.BigEndian.PutUint16(signed[10:12], arcount+1)
+
+	return signed, nil
+}
+
+// tsigTime works out the time signed, TimeSigned (or now) plus TimeSkew.
+func tsigTime(tsig *models.TSIG) (uint64, error) {
+	timeSigned := int64(tsig.TimeSigned)
+	if timeSigned == 0 {
+		timeSigned = time.Now().Unix()
+	}
+	timeSigned += tsig.TimeSkew
+
+	if timeSigned < 0 || timeSigned > maxTimeSigned {
+		return 0, fmt.Errorf("time signed %d (after a skew of %d) does not fit in 48 bits", timeSigned, tsig.TimeSkew)
+	}
+	return uint64(timeSigned), nil
+}
+
+// tsigMAC calculates the MAC over the request MAC (if any), the message and the TSIG variables of rr.
+func tsigMAC(msg []byte, rr *dns.TSIG, requestMAC []byte, secret []byte) ([]byte, error) {
+	var h hash.Hash
+	switch rr.Algorithm {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, secret)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, secret)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, secret)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, secret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, secret)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", rr.Algorithm)
+	}
+
+	// A response to a signed request starts with the request's MAC, prefixed by its size
+	if len(requestMAC) > 0 {
+		h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+		h.Write(requestMAC)
+	}
+
+	h.Write(msg)
+
+	// The TSIG variables: names in canonical (lowercase, uncompressed) form,
+	// then class, TTL, time signed, fudge, error and other data
+	variables := make([]byte, maxNameLength+1)
+	off, err := dns.PackDomainName(dns.CanonicalName(rr.Hdr.Name), variables, 0, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key name %s: %w", rr.Hdr.Name, err)
+	}
+	variables = variables[:off]
+	variables = binary.BigEndian.AppendUint16(variables, dns.ClassANY)
+	variables = binary.BigEndian.AppendUint32(variables, 0)
+
+	algorithm := make([]byte, maxNameLength+1)
+	off, err = dns.PackDomainName(dns.CanonicalName(rr.Algorithm), algorithm, 0, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid algorithm name %s: %w", rr.Algorithm, err)
+	}
+	variables = append(variables, algorithm[:off]...)
+
+	variables = binary.BigEndian.AppendUint16(variables, uint16(rr.TimeSigned>>32))
+	variables = binary.BigEndian.AppendUint32(variables, uint32(rr.TimeSigned))
+	variables = binary.BigEndian.AppendUint16(variables, rr.Fudge)
+	variables = binary.BigEndian.AppendUint16(variables, rr.Error)
+	variables = binary.BigEndian.AppendUint16(variables, 0) // other len
+
+	h.Write(variables)
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,138 @@
+package crafter
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"github.com/miekg/dns"
+)
+
+// maxTXTString is the maximum length of a single TXT character-string,
+// since its length is given by a single byte.
+const maxTXTString = 255
+
+// buildRecords translates a single models.Answer into its dns.RRs. That's a single
+// record, except for TXT data that's spread over several records (see models.TXTOptions).
+func buildRecords(answer models.Answer) ([]dns.RR, error) {
+	rr, err := buildRecord(answer)
+	if err != nil {
+		return nil, err
+	}
+	if !isTXTData(answer) || answer.TXT == nil {
+		return []dns.RR{rr}, nil
+	}
+
+	// Every record shares the header, only the strings differ
+	hdr := *rr.Header()
+
+	records, err := SplitTXT(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	var rrs []dns.RR
+	for _, txt := range records {
+		rrs = append(rrs, &dns.TXT{Hdr: hdr, Txt: txt})
+	}
+	return rrs, nil
+}
+
+// isTXTData reports whether the answer is a TXT record built from its data,
+// as opposed to raw RDATA.
+func isTXTData(answer models.Answer) bool {
+	return answer.Type == "TXT" && answer.TypeCode == 0 && answer.RawRData == "" && answer.RData == nil
+}
+
+// recordCount returns the number of records the answer is packed into.
+func recordCount(answer models.Answer) int {
+	if !isTXTData(answer) || answer.TXT == nil {
+		return 1
+	}
+	records, err := SplitTXT(answer)
+	if err != nil {
+		return 1
+	}
+	return len(records)
+}
+
+// SplitTXT cuts the data of a TXT answer into character-strings and spreads
+// them over records, following answer.TXT. It returns the strings of every record.
+func SplitTXT(answer models.Answer) ([][]string, error) {
+	options := models.TXTOptions{}
+	if answer.TXT != nil {
+		options = *answer.TXT
+	}
+
+	chunkSize := options.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = maxTXTString
+	}
+	if chunkSize < 1 || chunkSize > maxTXTString {
+		return nil, fmt.Errorf("txt.chunk_size must be between 1 and %d, but got %d", maxTXTString, options.ChunkSize)
+	}
+	if options.MaxStrings < 0 {
+		return nil, fmt.Errorf("txt.max_strings must not be negative, but got %d", options.MaxStrings)
+	}
+	if options.Records < 0 {
+		return nil, fmt.Errorf("txt.records must not be negative, but got %d", options.Records)
+	}
+
+	chunks := chunkTXT(answer.Data, chunkSize)
+
+	// Without a set number of records, we use as many as MaxStrings requires
+	records := options.Records
+	if records == 0 {
+		perRecord := len(chunks)
+		if options.MaxStrings > 0 {
+			perRecord = options.MaxStrings
+		}
+		records = (len(chunks) + perRecord - 1) / perRecord
+	}
+
+	// Spread the strings as evenly as possible, the first records get the remainder
+	perRecord := len(chunks) / records
+	remainder := len(chunks) % records
+
+	if most := perRecord + min(remainder, 1); options.MaxStrings > 0 && most > options.MaxStrings {
+		return nil, fmt.Errorf("data needs %d string(s) of %d bytes, which doesn't fit in %d record(s) of at most %d string(s)",
+			len(chunks), chunkSize, records, options.MaxStrings)
+	}
+
+	split := make([][]string, records)
+	next := 0
+	for i := range split {
+		count := perRecord
+		if i < remainder {
+			count++
+		}
+
+		// A TXT record needs at least one string, even if it's empty
+		if count == 0 {
+			split[i] = []string{""}
+			continue
+		}
+
+		split[i] = chunks[next : next+count]
+		next += count
+	}
+
+	return split, nil
+}
+
+// chunkTXT cuts data into strings of at most size bytes on the wire. Escapes such as \DDD
+// and \" are resolved first, so they're never split and count as the single byte they pack
+// into, and every string is escaped again for miekg. Empty data results in a single empty
+// string, since a TXT record needs at least one.
+func chunkTXT(data string, size int) []string {
+	if data == "" {
+		return []string{""}
+	}
+
+	raw := wire.UnescapeTXT(data)
+	var chunks []string
+	for len(raw) > size {
+		chunks = append(chunks, wire.EscapeTXT(raw[:size]))
+		raw = raw[size:]
+	}
+	return append(chunks, wire.EscapeTXT(raw))
+}
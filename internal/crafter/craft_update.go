@@ -0,0 +1,114 @@
+package crafter
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+)
+
+// buildZone creates the zone section of an update, which takes the place of the question.
+func buildZone(update models.Update) (dns.Question, error) {
+	class := update.Class
+	if class == "" {
+		class = "IN"
+	}
+	qClass, ok := models.QClassMap[class]
+	if !ok {
+		return dns.Question{}, fmt.Errorf("invalid zone class: %s", class)
+	}
+
+	return dns.Question{
+		Name:   dns.Fqdn(update.Zone),
+		Qtype:  dns.TypeSOA,
+		Qclass: qClass,
+	}, nil
+}
+
+// buildUpdate adds the prerequisites (answer section) and operations (authority section)
+// of an update to the message. miekg's update helpers take care of the class, TTL and
+// RDATA every kind of prerequisite and operation needs, so they need the zone section in place.
+func buildUpdate(msg *dns.Msg, update models.Update) error {
+	for i, prerequisite := range update.Prerequisites {
+		var rr dns.RR
+		var err error
+		if prerequisite.Condition == "rrset_exists_value" {
+			rr, err = updateRecord(prerequisite.Name, prerequisite.Type, 0, prerequisite.Data, prerequisite.RData)
+		} else {
+			rr, err = updateHeader(prerequisite.Name, prerequisite.Type, prerequisite.Condition == "name_in_use" || prerequisite.Condition == "name_not_in_use")
+		}
+		if err != nil {
+			return fmt.Errorf("prerequisite %d: %w", i, err)
+		}
+
+		switch prerequisite.Condition {
+		case "rrset_exists":
+			msg.RRsetUsed([]dns.RR{rr})
+		case "rrset_exists_value":
+			msg.Used([]dns.RR{rr})
+		case "rrset_not_exists":
+			msg.RRsetNotUsed([]dns.RR{rr})
+		case "name_in_use":
+			msg.NameUsed([]dns.RR{rr})
+		case "name_not_in_use":
+			msg.NameNotUsed([]dns.RR{rr})
+		default:
+			return fmt.Errorf("prerequisite %d: invalid condition: %s", i, prerequisite.Condition)
+		}
+	}
+
+	for i, operation := range update.Operations {
+		var rr dns.RR
+		var err error
+		if operation.Action == "add" || operation.Action == "delete" {
+			rr, err = updateRecord(operation.Name, operation.Type, operation.TTL, operation.Data, operation.RData)
+		} else {
+			rr, err = updateHeader(operation.Name, operation.Type, operation.Action == "delete_name")
+		}
+		if err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch operation.Action {
+		case "add":
+			msg.Insert([]dns.RR{rr})
+		case "delete_rrset":
+			msg.RemoveRRset([]dns.RR{rr})
+		case "delete_name":
+			msg.RemoveName([]dns.RR{rr})
+		case "delete":
+			msg.Remove([]dns.RR{rr})
+		default:
+			return fmt.Errorf("operation %d: invalid action: %s", i, operation.Action)
+		}
+	}
+
+	return nil
+}
+
+// updateRecord builds a complete record for the prerequisites and operations that carry RDATA.
+// Its class is set by the update helpers.
+func updateRecord(name string, rrType string, ttl uint32, data string, rdata *models.RData) (dns.RR, error) {
+	return buildRecord(models.Answer{
+		Name:     name,
+		Type:     rrType,
+		Class:    "IN",
+		StdClass: true,
+		TTL:      ttl,
+		Data:     data,
+		RData:    rdata,
+	})
+}
+
+// updateHeader builds a record without RDATA, for the prerequisites and operations that
+// only need a name (and type). The update helpers only look at its header.
+func updateHeader(name string, rrType string, nameOnly bool) (dns.RR, error) {
+	hdr := dns.RR_Header{Name: dns.Fqdn(name)}
+	if !nameOnly {
+		qType, ok := models.QTypeMap[rrType]
+		if !ok {
+			return nil, fmt.Errorf("invalid type: %s", rrType)
+		}
+		hdr.Rrtype = qType
+	}
+	return &dns.ANY{Hdr: hdr}, nil
+}
@@ -0,0 +1,243 @@
+package crafter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"strconv"
+	"strings"
+)
+
+// maxNameLength is the maximum length of a name on the wire (RFC 1035).
+const maxNameLength = 255
+
+// EncodePayload turns a payload into a series of DNS messages carrying it, along with a
+// manifest to reassemble it. Every message is a copy of template (for the header, resolver
+// and so on) with the question and answers replaced. The question name of every message is
+// "<sequence>.<domain>", and for subdomain placement "<chunk labels>.<sequence>.<domain>",
+// the chunk's labels going in front of the sequence label.
+func EncodePayload(payload []byte, template models.DNSRequest, options models.PayloadOptions) ([]models.DNSRequest, models.PayloadManifest, error) {
+	manifest := models.PayloadManifest{
+		Placement: options.Placement,
+		Encoding:  options.Encoding,
+		Domain:    dns.Fqdn(options.Domain),
+		Size:      len(payload),
+		SHA256:    fmt.Sprintf("%x", sha256.Sum256(payload)),
+	}
+
+	if _, ok := dns.IsDomainName(manifest.Domain); !ok {
+		return nil, manifest, fmt.Errorf("invalid domain: %s", options.Domain)
+	}
+
+	encoded, err := EncodeData(payload, options.Encoding)
+	if err != nil {
+		return nil, manifest, err
+	}
+
+	// The sequence numbers all have the same width, enough for one chunk per character
+	sequenceWidth := len(strconv.Itoa(len(encoded)))
+
+	chunkSize, err := payloadChunkSize(options, manifest.Domain, sequenceWidth)
+	if err != nil {
+		return nil, manifest, err
+	}
+
+	var requests []models.DNSRequest
+	for sequence := 0; len(encoded) > 0; sequence++ {
+		chunk := encoded[:min(chunkSize, len(encoded))]
+		encoded = encoded[len(chunk):]
+
+		name := fmt.Sprintf("%0*d.%s", sequenceWidth, sequence, manifest.Domain)
+
+		request, err := payloadRequest(template, options, name, chunk)
+		if err != nil {
+			return nil, manifest, fmt.Errorf("chunk %d: %w", sequence, err)
+		}
+
+		requests = append(requests, request)
+		manifest.Chunks = append(manifest.Chunks, models.PayloadChunk{
+			Sequence: sequence,
+			Name:     request.Question.Name,
+			Data:     chunk,
+		})
+	}
+
+	return requests, manifest, nil
+}
+
+// payloadChunkSize works out how many encoded characters go in every message.
+func payloadChunkSize(options models.PayloadOptions, domain string, sequenceWidth int) (int, error) {
+	if options.ChunkSize < 0 {
+		return 0, fmt.Errorf("chunk size must not be negative, but got %d", options.ChunkSize)
+	}
+
+	if options.Placement != "subdomain" {
+		if options.ChunkSize == 0 {
+			return maxTXTString, nil
+		}
+		return options.ChunkSize, nil
+	}
+
+	labelSize := options.LabelSize
+	if labelSize == 0 {
+		labelSize = 63
+	}
+	if labelSize < 1 || labelSize > 63 {
+		return 0, fmt.Errorf("label size must be between 1 and 63, but got %d", options.LabelSize)
+	}
+
+	// Whatever's left of the name after the sequence label and the domain (which
+	// on the wire is as long as its presentation form plus the root label)
+	available := maxNameLength - (1 + sequenceWidth) - (len(domain) + 1)
+
+	// Every label costs a length byte on top of its characters
+	fit := available / (labelSize + 1) * labelSize
+	if rest := available % (labelSize + 1); rest > 1 {
+		fit += rest - 1
+	}
+
+	if fit < 1 {
+		return 0, fmt.Errorf("domain %s leaves no room for data in the name", domain)
+	}
+	if options.ChunkSize == 0 {
+		return fit, nil
+	}
+	if options.ChunkSize > fit {
+		return 0, fmt.Errorf("chunk size %d doesn't fit in a name under %s, at most %d characters do", options.ChunkSize, domain, fit)
+	}
+	return options.ChunkSize, nil
+}
+
+// payloadRequest creates the message carrying a single chunk.
+func payloadRequest(template models.DNSRequest, options models.PayloadOptions, name string, chunk string) (models.DNSRequest, error) {
+	request := template
+	request.Questions = nil
+	request.Question = models.Question{
+		Name:     name,
+		Type:     template.Question.Type,
+		StdType:  true,
+		Class:    "IN",
+		StdClass: true,
+	}
+
+	// Answers keep the template's TTL, if it has one
+	var ttl uint32 = 300
+	if len(template.Answers) > 0 {
+		ttl = template.Answers[0].TTL
+	}
+
+	switch options.Placement {
+	case "subdomain":
+		// Split the chunk over labels, which go in front of the sequence label
+		labelSize := options.LabelSize
+		if labelSize == 0 {
+			labelSize = 63
+		}
+		var labels []string
+		for len(chunk) > labelSize {
+			labels = append(labels, chunk[:labelSize])
+			chunk = chunk[labelSize:]
+		}
+		labels = append(labels, chunk)
+
+		request.Header.QR = false
+		request.Question.Name = strings.Join(labels, ".") + "." + name
+		request.Answers = nil
+		if request.Question.Type == "" {
+			request.Question.Type = "A"
+		}
+
+	case "txt":
+		request.Header.QR = true
+		request.Question.Type = "TXT"
+		request.Answers = []models.Answer{{
+			Name:     name,
+			Type:     "TXT",
+			Class:    "IN",
+			StdClass: true,
+			TTL:      ttl,
+			Data:     chunk,
+		}}
+
+	case "null":
+		request.Header.QR = true
+		request.Question.Type = "NULL"
+		request.Answers = []models.Answer{{
+			Name:     name,
+			Type:     "NULL",
+			Class:    "IN",
+			StdClass: true,
+			TTL:      ttl,
+			RData:    &models.RData{Hex: hex.EncodeToString([]byte(chunk))},
+		}}
+
+	default:
+		return request, fmt.Errorf("invalid placement: %s", options.Placement)
+	}
+
+	return request, nil
+}
+
+// EncodeData encodes data using hex, base32, base64 or base64url.
+func EncodeData(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base32":
+		return base32.StdEncoding.EncodeToString(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "base64url":
+		return base64.URLEncoding.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("invalid encoding: %s", encoding)
+}
+
+// DecodeData reverses EncodeData.
+func DecodeData(data string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "hex":
+		return hex.DecodeString(data)
+	case "base32":
+		return base32.StdEncoding.DecodeString(data)
+	case "base64":
+		return base64.StdEncoding.DecodeString(data)
+	case "base64url":
+		return base64.URLEncoding.DecodeString(data)
+	}
+	return nil, fmt.Errorf("invalid encoding: %s", encoding)
+}
+
+// ReassemblePayload puts the chunks of a manifest back together, in sequence order,
+// and verifies the result against the size and hash of the original payload.
+func ReassemblePayload(manifest models.PayloadManifest) ([]byte, error) {
+	chunks := make([]string, len(manifest.Chunks))
+	for _, chunk := range manifest.Chunks {
+		if chunk.Sequence < 0 || chunk.Sequence >= len(chunks) || chunks[chunk.Sequence] != "" {
+			return nil, fmt.Errorf("chunk sequence %d is out of range or duplicated", chunk.Sequence)
+		}
+		chunks[chunk.Sequence] = chunk.Data
+	}
+
+	payload, err := DecodeData(strings.Join(chunks, ""), manifest.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the chunks: %w", err)
+	}
+
+	if len(payload) != manifest.Size {
+		return nil, fmt.Errorf("reassembled payload is %d bytes, but the manifest says %d", len(payload), manifest.Size)
+	}
+
+	hash := sha256.Sum256(payload)
+	expected, err := hex.DecodeString(manifest.SHA256)
+	if err != nil || !bytes.Equal(hash[:], expected) {
+		return nil, fmt.Errorf("reassembled payload's SHA256 %x doesn't match the manifest", hash)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,234 @@
+package crafter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRandomHex is the number of characters {{random_hex}} expands to without an argument
+	defaultRandomHex = 8
+
+	// defaultSeqWidth is the number of digits {{seq_chunk}} is padded to without an argument
+	defaultSeqWidth = 4
+
+	// maxLabelLength is the maximum length of a single label (RFC 1035)
+	maxLabelLength = 63
+)
+
+// placeholderPattern matches a placeholder such as {{counter}} or {{random_hex 8}}.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(\w+)((?:\s+\S+?)*)\s*\}\}`)
+
+// PlaceholderField is a string field of a config that may hold placeholders.
+type PlaceholderField struct {
+	Name  string // e.g. "question.name" or "answers[1].data"
+	Value *string
+}
+
+// PlaceholderFields returns the fields of req that placeholders are expanded in: the
+// question names, and the names and data of the answer, authority and additional records.
+// The values point into req, so setting them changes req.
+func PlaceholderFields(req *models.DNSRequest) []PlaceholderField {
+	var fields []PlaceholderField
+
+	if len(req.Questions) > 0 {
+		for i := range req.Questions {
+			fields = append(fields, PlaceholderField{fmt.Sprintf("questions[%d].name", i), &req.Questions[i].Name})
+		}
+	} else {
+		fields = append(fields, PlaceholderField{"question.name", &req.Question.Name})
+	}
+
+	sections := []struct {
+		name    string
+		records []models.Answer
+	}{
+		{"answers", req.Answers},
+		{"authority", req.Authority},
+		{"additional", req.Additional},
+	}
+	for _, section := range sections {
+		for i := range section.records {
+			field := fmt.Sprintf("%s[%d]", section.name, i)
+			fields = append(fields,
+				PlaceholderField{field + ".name", &section.records[i].Name},
+				PlaceholderField{field + ".data", &section.records[i].Data},
+			)
+		}
+	}
+
+	return fields
+}
+
+// CheckPlaceholders checks the syntax of every placeholder in s, without expanding them.
+func CheckPlaceholders(s string) error {
+	_, err := NewExpander().expand(s)
+	return err
+}
+
+// Expander expands the placeholders in a config, once for every message sent:
+//
+//	{{counter}}       - the number of the message, starting at 1 (or at the argument, e.g. {{counter 100}})
+//	{{seq_chunk}}     - the number of the message starting at 0, zero-padded to 4 digits (or the
+//	                    argument, e.g. {{seq_chunk 6}}), like the sequence label of cmd/encode's chunks
+//	{{random_hex}}    - 8 random hex characters (or the argument, e.g. {{random_hex 16}})
+//	{{timestamp}}     - the current time as a Unix timestamp
+//	{{hostname}}      - the (lowercase) hostname of the machine sending the message
+type Expander struct {
+	send     int
+	rng      *rand.Rand
+	hostname string
+}
+
+// NewExpander creates an expander, random values are seeded from the clock.
+func NewExpander() *Expander {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &Expander{
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		hostname: strings.ToLower(hostname),
+	}
+}
+
+// Sent returns the number of messages expanded so far.
+func (e *Expander) Sent() int {
+	return e.send
+}
+
+// SetSent sets the number of messages expanded so far, so {{counter}} and {{seq_chunk}}
+// carry on where an earlier run (e.g. an earlier run of the agent) left off.
+func (e *Expander) SetSent(n int) {
+	e.send = n
+}
+
+// UsesSendCount reports whether any field of req holds {{counter}} or {{seq_chunk}},
+// the placeholders that depend on the number of messages sent before.
+func UsesSendCount(req models.DNSRequest) bool {
+	for _, field := range PlaceholderFields(&req) {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(*field.Value, -1) {
+			if match[1] == "counter" || match[1] == "seq_chunk" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Expand returns a copy of req with the placeholders in its fields expanded for the next message.
+func (e *Expander) Expand(req models.DNSRequest) (models.DNSRequest, error) {
+	expanded := req
+
+	// The records are changed through pointers, so they need copies of their own
+	expanded.Questions = append([]models.Question(nil), req.Questions...)
+	expanded.Answers = append([]models.Answer(nil), req.Answers...)
+	expanded.Authority = append([]models.Answer(nil), req.Authority...)
+	expanded.Additional = append([]models.Answer(nil), req.Additional...)
+
+	for _, field := range PlaceholderFields(&expanded) {
+		value, err := e.expand(*field.Value)
+		if err != nil {
+			return req, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		*field.Value = value
+	}
+
+	e.send++
+	return expanded, nil
+}
+
+// expand replaces every placeholder in s. Anything that looks like the start or
+// end of a placeholder, but isn't part of a valid one, is an error.
+func (e *Expander) expand(s string) (string, error) {
+	var firstErr error
+
+	expanded := placeholderPattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		matches := placeholderPattern.FindStringSubmatch(placeholder)
+		value, err := e.value(matches[1], strings.Fields(matches[2]))
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", placeholder, err)
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	if strings.Contains(expanded, "{{") || strings.Contains(expanded, "}}") {
+		return "", fmt.Errorf("unterminated or malformed placeholder in %q, expected e.g. {{counter}} or {{random_hex 8}}", s)
+	}
+	return expanded, nil
+}
+
+// value works out the value of a single placeholder.
+func (e *Expander) value(name string, args []string) (string, error) {
+	// intArg returns the only argument as a number between lowest and highest, or def if there is none
+	intArg := func(def, lowest, highest int) (int, error) {
+		if len(args) == 0 {
+			return def, nil
+		}
+		if len(args) > 1 {
+			return 0, fmt.Errorf("takes at most one argument, but got %d", len(args))
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < lowest || n > highest {
+			return 0, fmt.Errorf("argument must be a number between %d and %d, but got %s", lowest, highest, args[0])
+		}
+		return n, nil
+	}
+
+	noArgs := func() error {
+		if len(args) > 0 {
+			return fmt.Errorf("takes no arguments")
+		}
+		return nil
+	}
+
+	switch name {
+	case "counter":
+		start, err := intArg(1, 0, 1<<31-1)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(start + e.send), nil
+
+	case "seq_chunk":
+		width, err := intArg(defaultSeqWidth, 1, maxLabelLength)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%0*d", width, e.send), nil
+
+	case "random_hex":
+		length, err := intArg(defaultRandomHex, 1, maxNameLength)
+		if err != nil {
+			return "", err
+		}
+		data := make([]byte, (length+1)/2)
+		e.rng.Read(data)
+		return hex.EncodeToString(data)[:length], nil
+
+	case "timestamp":
+		if err := noArgs(); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+
+	case "hostname":
+		if err := noArgs(); err != nil {
+			return "", err
+		}
+		return e.hostname, nil
+	}
+
+	return "", fmt.Errorf("unknown placeholder, expected counter, seq_chunk, random_hex, timestamp or hostname")
+}
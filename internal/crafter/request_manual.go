@@ -19,24 +19,52 @@ func ApplyManualOverride(packedMsg []byte, header models.Header) error {
 
 	// --- Manipulate the Z flag ---
 
-	// 1. Create a "clearing mask" to set the 3 Z bits to 0.
-	// The Z bits are bits 4, 5, and 6 from the left of this field.
-	// In a 16-bit number, this corresponds to bits 9, 8, and 7.
-	// Mask in binary: 1111 1111 1000 1111
-	// Mask in hex:   0x  F    F    8    F
-	const zClearMask uint16 = 0xFF8F
+	// RFC 1035 reserved 3 bits for Z, but the lower 2 are now AD and CD,
+	// which miekg packs for us. So we only touch the one bit that's left.
+
+	// 1. Create a "clearing mask" to set the Z bit to 0.
+	// The Z bit is bit 9 from the left of this field (right after RA).
+	// In a 16-bit number, this corresponds to bit 6.
+	// Mask in binary: 1111 1111 1011 1111
+	// Mask in hex:   0x  F    F    B    F
+	const zClearMask uint16 = 0xFFBF
 	flags &= zClearMask
 
-	// 2. Prepare our desired Z value. It's a 3-bit value (0-7).
-	// We must shift it left by 4 bits to align it with the RCODE field.
-	zValue := uint16(header.Z) << 4
+	// 2. Prepare our desired Z value. It's a 1-bit value (0-1).
+	// We must shift it left by 6 bits to skip past CD, AD and the RCODE field.
+	zValue := uint16(header.Z&0x01) << 6
 
 	// 3. Use a bitwise OR to apply our shifted Z value to the cleared flags.
 	flags |= zValue
 
+	// --- Manipulate the OpCode ---
+
+	// miekg packs any 4-bit opcode, but for custom opcodes we write the
+	// value ourselves so the reserved ones (7 - 15) land on the wire verbatim.
+	// The OpCode bits are bits 1 - 4 from the left of this field.
+	// Mask in binary: 1000 0111 1111 1111
+	if !header.UsesStdOpCode() {
+		const opCodeClearMask uint16 = 0x87FF
+		flags &= opCodeClearMask
+		flags |= uint16(header.CustomOpCode&0x0F) << 11
+	}
+
 	// --- Write the modified flags back into the byte slice ---
 	binary.BigEndian.PutUint16(packedMsg[2:4], flags)
 
+	// --- Overwrite the section counts ---
+
+	// The 4 counts follow the flags, each a 16-bit integer (indices 4 - 11).
+	// These no longer have to match the sections actually present.
+	if overrides := header.CountOverrides; overrides != nil {
+		counts := []*uint16{overrides.QDCount, overrides.ANCount, overrides.NSCount, overrides.ARCount}
+		for i, count := range counts {
+			if count != nil {
+				binary.BigEndian.PutUint16(packedMsg[4+i*2:6+i*2], *count)
+			}
+		}
+	}
+
 	//fmt.Printf("\n>>> Manually set Z flag to %d. New flags value: 0x%04X\n", header.Z, flags)
 
 	return nil
@@ -0,0 +1,398 @@
+// Package fuzz mutates crafted packets and sends them to a target, to see what breaks it.
+// Every mutation is expressed as a models.Patch, so a failing case can be replayed
+// by appending its patches to the config the packet was crafted from.
+package fuzz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"math/bits"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// Kinds lists the mutations the Mutator can apply:
+//
+//	bit_flip     - flips a single bit anywhere in the packet
+//	header       - changes a header flag or section count
+//	type_class   - changes the type or class of a question or record
+//	label_splice - overwrites a label with a label taken from another name
+//	length       - corrupts a label length or an RDLENGTH
+var Kinds = []string{"bit_flip", "header", "type_class", "label_splice", "length"}
+
+// maxAttempts is how many times, per mutation, we try to find one that applies to the packet.
+// Not every mutation does, e.g. there's no RDLENGTH to corrupt in a query.
+const maxAttempts = 10
+
+// interesting16 are the 16-bit values most likely to trip up a parser: zero, OPT, TSIG,
+// the meta types (IXFR through ANY), and the edges of the signed and unsigned range.
+var interesting16 = []uint16{0, 1, 41, 250, 251, 252, 253, 254, 255, 0x7FFF, 0x8000, 0xFF00, 0xFFFF}
+
+// labelLengths are the label lengths most likely to trip up a parser: empty, the longest
+// allowed, one too long, the reserved and pointer prefixes, and every bit set.
+var labelLengths = []byte{0, 1, 63, 64, 0x80, 0xC0, 0xFF}
+
+// headerFlag is a flag (or multi-bit field) in the second word of the header.
+type headerFlag struct {
+	name string
+	mask uint16
+}
+
+var headerFlags = []headerFlag{
+	{"QR", 0x8000},
+	{"Opcode", 0x7800},
+	{"AA", 0x0400},
+	{"TC", 0x0200},
+	{"RD", 0x0100},
+	{"RA", 0x0080},
+	{"Z", 0x0040},
+	{"AD", 0x0020},
+	{"CD", 0x0010},
+	{"RCODE", 0x000F},
+}
+
+// Mutation is a single change made to a packet.
+type Mutation struct {
+	Kind        string
+	Description string
+	Patch       models.Patch
+}
+
+// Mutator applies random mutations to packets. Seeded the same way,
+// it makes the same mutations to the same packets.
+type Mutator struct {
+	rng   *rand.Rand
+	kinds []string
+}
+
+// NewMutator creates a mutator that picks from the given kinds of mutations, or from all of them if none are given.
+func NewMutator(seed int64, kinds []string) (*Mutator, error) {
+	if len(kinds) == 0 {
+		kinds = Kinds
+	}
+	for _, kind := range kinds {
+		if !slices.Contains(Kinds, kind) {
+			return nil, fmt.Errorf("unknown mutation '%s', expected one of: %s", kind, strings.Join(Kinds, ", "))
+		}
+	}
+
+	return &Mutator{
+		rng:   rand.New(rand.NewSource(seed)),
+		kinds: kinds,
+	}, nil
+}
+
+// Mutate applies between 1 and maxMutations mutations to a copy of packet. They're applied one after
+// the other, so each sees the packet as the ones before it left it, just like the patches do
+// when the case is replayed. A maxMutations below 1 counts as 1, so there's always a mutation.
+func (m *Mutator) Mutate(packet []byte, maxMutations int) ([]byte, []Mutation) {
+	n := 1 + m.rng.Intn(max(maxMutations, 1))
+	msg := bytes.Clone(packet)
+	var mutations []Mutation
+
+	for attempts := 0; len(mutations) < n && attempts < n*maxAttempts; attempts++ {
+		kind := m.kinds[m.rng.Intn(len(m.kinds))]
+		mutation, ok := m.mutation(kind, msg)
+		if !ok {
+			continue
+		}
+
+		// Applying the patch the same way a replay would makes sure it can be replayed
+		patched, _, err := crafter.ApplyPatches(bytes.Clone(msg), []models.Patch{mutation.Patch})
+		if err != nil {
+			continue
+		}
+		msg = patched
+		mutations = append(mutations, mutation)
+	}
+
+	return msg, mutations
+}
+
+// mutation creates a mutation of the given kind for msg, if there is one that applies.
+func (m *Mutator) mutation(kind string, msg []byte) (Mutation, bool) {
+	// Offsets in patches are 16 bits, so are those of any DNS message
+	if len(msg) == 0 || len(msg) > 0xFFFF {
+		return Mutation{}, false
+	}
+
+	if kind == "bit_flip" {
+		return m.bitFlip(msg)
+	}
+
+	layout, err := wire.Walk(msg)
+	if err != nil {
+		return Mutation{}, false
+	}
+
+	switch kind {
+	case "header":
+		return m.header(msg)
+	case "type_class":
+		return m.typeClass(msg, entries(layout))
+	case "label_splice":
+		return m.labelSplice(msg, entries(layout))
+	case "length":
+		return m.length(msg, entries(layout))
+	}
+	return Mutation{}, false
+}
+
+// bitFlip flips a random bit of a random byte.
+func (m *Mutator) bitFlip(msg []byte) (Mutation, bool) {
+	off := m.rng.Intn(len(msg))
+	bit := m.rng.Intn(8)
+	mask := byte(0x80) >> bit
+
+	offset := uint16(off)
+	return Mutation{
+		Kind:        "bit_flip",
+		Description: fmt.Sprintf("flip bit %d of byte %d", bit, off),
+		Patch: models.Patch{
+			Offset: &offset,
+			Mask:   hex.EncodeToString([]byte{mask}),
+			Value:  hex.EncodeToString([]byte{(msg[off] ^ mask) & mask}),
+		},
+	}, true
+}
+
+// header changes a random flag, or one of the section counts.
+func (m *Mutator) header(msg []byte) (Mutation, bool) {
+	if m.rng.Intn(2) == 0 {
+		flag := headerFlags[m.rng.Intn(len(headerFlags))]
+		current := binary.BigEndian.Uint16(msg[2:4]) & flag.mask
+
+		// Single bit flags are toggled, fields get a random value
+		value := current ^ flag.mask
+		if bits.OnesCount16(flag.mask) > 1 {
+			value = uint16(m.rng.Intn(0x10000)) & flag.mask
+		}
+		shift := bits.TrailingZeros16(flag.mask)
+
+		return Mutation{
+			Kind:        "header",
+			Description: fmt.Sprintf("set %s to %d (was %d)", flag.name, value>>shift, current>>shift),
+			Patch: models.Patch{
+				Anchor: "header.flags",
+				Mask:   hex.EncodeToString(binary.BigEndian.AppendUint16(nil, flag.mask)),
+				Value:  hex.EncodeToString(binary.BigEndian.AppendUint16(nil, value)),
+			},
+		}, true
+	}
+
+	counts := []string{"qdcount", "ancount", "nscount", "arcount"}
+	i := m.rng.Intn(len(counts))
+	off := 4 + 2*i
+	current := binary.BigEndian.Uint16(msg[off : off+2])
+	value := m.value16(current)
+
+	return Mutation{
+		Kind:        "header",
+		Description: fmt.Sprintf("set %s to %d (was %d)", strings.ToUpper(counts[i]), value, current),
+		Patch: models.Patch{
+			Anchor: "header." + counts[i],
+			Bytes:  hex.EncodeToString(binary.BigEndian.AppendUint16(nil, value)),
+		},
+	}, true
+}
+
+// typeClass changes the type or class of a random question or record.
+func (m *Mutator) typeClass(msg []byte, es []entry) (Mutation, bool) {
+	if len(es) == 0 {
+		return Mutation{}, false
+	}
+	e := es[m.rng.Intn(len(es))]
+
+	field, off := "type", e.typeOffset
+	if m.rng.Intn(2) == 0 {
+		field, off = "class", e.classOffset
+	}
+	current := binary.BigEndian.Uint16(msg[off : off+2])
+	value := m.value16(current)
+
+	return Mutation{
+		Kind:        "type_class",
+		Description: fmt.Sprintf("set %s of %s to %d (was %d)", field, e.ref, value, current),
+		Patch: models.Patch{
+			Anchor: e.ref + "." + field,
+			Bytes:  hex.EncodeToString(binary.BigEndian.AppendUint16(nil, value)),
+		},
+	}, true
+}
+
+// labelSplice overwrites a label of one name with a label (length byte included) of another,
+// or of the same name. Splicing never grows the packet, a label that doesn't fit is cut short.
+// When the labels differ in length, everything that follows is shifted for a parser.
+func (m *Mutator) labelSplice(msg []byte, es []entry) (Mutation, bool) {
+	if len(es) == 0 {
+		return Mutation{}, false
+	}
+	src := es[m.rng.Intn(len(es))]
+	dst := es[m.rng.Intn(len(es))]
+
+	srcLabels := labelOffsets(msg, src.nameOffset)
+	dstLabels := labelOffsets(msg, dst.nameOffset)
+	if len(srcLabels) == 0 || len(dstLabels) == 0 {
+		return Mutation{}, false
+	}
+
+	si := m.rng.Intn(len(srcLabels))
+	di := m.rng.Intn(len(dstLabels))
+	s, d := srcLabels[si], dstLabels[di]
+
+	label := msg[s : s+1+int(msg[s])]
+	label = label[:min(len(label), len(msg)-d)]
+
+	offset := uint16(d - dst.nameOffset)
+	return Mutation{
+		Kind:        "label_splice",
+		Description: fmt.Sprintf("splice label %d of %s (%q) over label %d of %s", si, src.ref, msg[s+1:s+1+int(msg[s])], di, dst.ref),
+		Patch: models.Patch{
+			Anchor: dst.ref + ".name",
+			Offset: &offset,
+			Bytes:  hex.EncodeToString(label),
+		},
+	}, true
+}
+
+// length corrupts the length byte of a random label, or the RDLENGTH of a random record.
+func (m *Mutator) length(msg []byte, es []entry) (Mutation, bool) {
+	if len(es) == 0 {
+		return Mutation{}, false
+	}
+	e := es[m.rng.Intn(len(es))]
+
+	if e.rdlengthOffset >= 0 && m.rng.Intn(2) == 0 {
+		current := binary.BigEndian.Uint16(msg[e.rdlengthOffset : e.rdlengthOffset+2])
+		value := m.value16(current)
+
+		return Mutation{
+			Kind:        "length",
+			Description: fmt.Sprintf("set RDLENGTH of %s to %d (was %d)", e.ref, value, current),
+			Patch: models.Patch{
+				Anchor: e.ref + ".rdlength",
+				Bytes:  hex.EncodeToString(binary.BigEndian.AppendUint16(nil, value)),
+			},
+		}, true
+	}
+
+	labels := labelOffsets(msg, e.nameOffset)
+	if len(labels) == 0 {
+		return Mutation{}, false
+	}
+	i := m.rng.Intn(len(labels))
+	off := labels[i]
+	current := msg[off]
+
+	var value byte
+	switch m.rng.Intn(3) {
+	case 0:
+		value = current + 1
+	case 1:
+		value = current - 1
+	default:
+		value = labelLengths[m.rng.Intn(len(labelLengths))]
+	}
+	if value == current {
+		value = current + 1
+	}
+
+	offset := uint16(off - e.nameOffset)
+	return Mutation{
+		Kind:        "length",
+		Description: fmt.Sprintf("set length of label %d of %s to %d (was %d)", i, e.ref, value, current),
+		Patch: models.Patch{
+			Anchor: e.ref + ".name",
+			Offset: &offset,
+			Bytes:  hex.EncodeToString([]byte{value}),
+		},
+	}, true
+}
+
+// value16 picks a new value for a 16-bit field: an interesting one, one off the current one, or a random one.
+func (m *Mutator) value16(current uint16) uint16 {
+	var value uint16
+	switch m.rng.Intn(3) {
+	case 0:
+		value = interesting16[m.rng.Intn(len(interesting16))]
+	case 1:
+		value = current + 1
+		if m.rng.Intn(2) == 0 {
+			value = current - 1
+		}
+	default:
+		value = uint16(m.rng.Intn(0x10000))
+	}
+
+	// A mutation that changes nothing is a wasted packet
+	if value == current {
+		value = current + 1
+	}
+	return value
+}
+
+// entry is a question or record of the packet, as the anchor prefix and offsets of its fields.
+type entry struct {
+	ref            string // e.g. "question[0]" or "answer[1]"
+	nameOffset     int
+	typeOffset     int
+	classOffset    int
+	rdlengthOffset int // -1 for questions
+}
+
+// entries lists the questions and records in the layout. Records past the
+// declared counts are left out, there is no anchor to replay them with.
+func entries(layout *wire.Layout) []entry {
+	var es []entry
+	for i, q := range layout.Questions {
+		es = append(es, entry{
+			ref:            fmt.Sprintf("question[%d]", i),
+			nameOffset:     q.NameOffset,
+			typeOffset:     q.TypeOffset,
+			classOffset:    q.ClassOffset,
+			rdlengthOffset: -1,
+		})
+	}
+
+	sections := []struct {
+		name    string
+		records []wire.Record
+	}{
+		{"answer", layout.Answers},
+		{"authority", layout.Authority},
+		{"additional", layout.Additional},
+	}
+	for _, section := range sections {
+		for i, r := range section.records {
+			es = append(es, entry{
+				ref:            fmt.Sprintf("%s[%d]", section.name, i),
+				nameOffset:     r.NameOffset,
+				typeOffset:     r.TypeOffset,
+				classOffset:    r.ClassOffset,
+				rdlengthOffset: r.RDLengthOffset,
+			})
+		}
+	}
+	return es
+}
+
+// labelOffsets returns the offsets of the length bytes of the labels of the name at off.
+// It stops at the root label or a pointer, neither of which is included.
+func labelOffsets(msg []byte, off int) []int {
+	var offsets []int
+	for off < len(msg) {
+		length := int(msg[off])
+		if length == 0 || length&0xC0 != 0 || off+1+length > len(msg) {
+			break
+		}
+		offsets = append(offsets, off)
+		off += 1 + length
+	}
+	return offsets
+}
@@ -0,0 +1,100 @@
+package fuzz
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net"
+	"time"
+)
+
+// Outcome is what happened when a mutated packet was sent to the target.
+type Outcome string
+
+const (
+	OutcomeOK           Outcome = "ok"            // The target answered with a message we could parse
+	OutcomeTimeout      Outcome = "timeout"       // No answer, but the target still answers the unmutated packet
+	OutcomeCrash        Outcome = "crash"         // No answer, and the target no longer answers the unmutated packet either
+	OutcomeParseFailure Outcome = "parse_failure" // The target answered with a message we couldn't parse
+	OutcomeSendError    Outcome = "send_error"    // We failed to send the packet, the target never saw it
+)
+
+// Failing reports whether the outcome is worth saving as a case.
+func (o Outcome) Failing() bool {
+	return o == OutcomeTimeout || o == OutcomeCrash || o == OutcomeParseFailure
+}
+
+// Result is the outcome of sending a single packet.
+type Result struct {
+	Outcome  Outcome
+	Err      error
+	Response []byte
+}
+
+// Target is a DNS server (under our control) we send mutated packets to over UDP.
+type Target struct {
+	Address string
+	Timeout time.Duration
+}
+
+// Send sends a packet to the target and waits for its response.
+// Unlike network.SendAndReceivePacket it prints nothing, since we send thousands of them.
+func (t Target) Send(packet []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", t.Address, t.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(t.Timeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, fmt.Errorf("failed to send packet: %w", err)
+	}
+
+	response := make([]byte, dns.MaxMsgSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return response[:n], nil
+}
+
+// Alive reports whether the target answers the given (unmutated) packet.
+// It gets a second chance, UDP packets do get lost.
+func (t Target) Alive(base []byte) bool {
+	for range 2 {
+		if _, err := t.Send(base); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Run sends a mutated packet to the target and works out the outcome. Without a response,
+// we check whether the target still answers the base packet, to tell a target that
+// ignored (or choked on) the packet apart from one that's no longer there.
+func (t Target) Run(packet []byte, base []byte) Result {
+	response, err := t.Send(packet)
+	if err != nil {
+		if !t.Alive(base) {
+			return Result{Outcome: OutcomeCrash, Err: err}
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return Result{Outcome: OutcomeTimeout, Err: err}
+		}
+		// Anything else, e.g. a packet too large to send, is on our side
+		return Result{Outcome: OutcomeSendError, Err: err}
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(response); err != nil {
+		return Result{Outcome: OutcomeParseFailure, Err: err, Response: response}
+	}
+
+	return Result{Outcome: OutcomeOK, Response: response}
+}
@@ -0,0 +1,40 @@
+package models
+
+// FuzzReport summarises a fuzzing run, along with every failing case it found.
+type FuzzReport struct {
+	// Template and Target: The config the packets were mutated from, and where they were sent
+	Template string `yaml:"template"`
+	Target   string `yaml:"target"`
+
+	// Seed: Running again with the same seed, template and mutations sends the same packets
+	Seed int64 `yaml:"seed"`
+
+	// Iterations: How many mutated packets were sent
+	Iterations int `yaml:"iterations"`
+
+	// Outcomes: How many packets ended in each outcome (ok, timeout, crash, parse_failure, send_error)
+	Outcomes map[string]int `yaml:"outcomes"`
+
+	Findings []FuzzFinding `yaml:"findings"`
+}
+
+// FuzzFinding is a single failing case. Config is the template with the mutations
+// appended to its patches, so it can be built and sent again to reproduce the failure.
+type FuzzFinding struct {
+	// Case: The iteration the case was found in
+	Case int `yaml:"case"`
+
+	// Outcome: timeout, crash or parse_failure
+	Outcome string `yaml:"outcome"`
+	Error   string `yaml:"error,omitempty"`
+
+	// Mutations: What was done to the packet, in the order it was done
+	Mutations []string `yaml:"mutations"`
+
+	// Config and Hex: The files holding the replayable config and the raw packet
+	Config string `yaml:"config"`
+	Hex    string `yaml:"hex"`
+
+	// Response: parse_failure, the response that couldn't be parsed as a hex string
+	Response string `yaml:"response,omitempty"`
+}
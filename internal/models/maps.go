@@ -109,3 +109,37 @@ var QTypeMap = map[string]uint16{
 	"IXFR": dns.TypeIXFR,
 	"OPT":  dns.TypeOPT,
 }
+
+var EDNSOptionMap = map[string]uint16{
+	"LLQ":           dns.EDNS0LLQ,
+	"UL":            dns.EDNS0UL,
+	"NSID":          dns.EDNS0NSID,
+	"ESU":           dns.EDNS0ESU,
+	"DAU":           dns.EDNS0DAU,
+	"DHU":           dns.EDNS0DHU,
+	"N3U":           dns.EDNS0N3U,
+	"SUBNET":        dns.EDNS0SUBNET,
+	"EXPIRE":        dns.EDNS0EXPIRE,
+	"COOKIE":        dns.EDNS0COOKIE,
+	"TCP_KEEPALIVE": dns.EDNS0TCPKEEPALIVE,
+	"PADDING":       dns.EDNS0PADDING,
+	"EDE":           dns.EDNS0EDE,
+}
+
+// TSIGAlgorithmMap maps the TSIG algorithms we can sign with to their names on the wire
+var TSIGAlgorithmMap = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// DNSSECAlgorithmMap maps the DNSSEC algorithms we can generate keys for to their numbers
+var DNSSECAlgorithmMap = map[string]uint8{
+	"RSASHA256":       dns.RSASHA256,
+	"RSASHA512":       dns.RSASHA512,
+	"ECDSAP256SHA256": dns.ECDSAP256SHA256,
+	"ECDSAP384SHA384": dns.ECDSAP384SHA384,
+	"ED25519":         dns.ED25519,
+}
@@ -1,6 +1,9 @@
 package models
 
-import "github.com/miekg/dns"
+import (
+	"fmt"
+	"github.com/miekg/dns"
+)
 
 // DNSRequest will hold the complete agent-side
 // configuration parsed from configs/request.yaml
@@ -8,34 +11,164 @@ import "github.com/miekg/dns"
 type DNSRequest struct {
 	Header   Header   `yaml:"header"`
 	Question Question `yaml:"question"`
-	Resolver Resolver `yaml:"resolver"`
-	Answers  []Answer `yaml:"answers,omitempty"`
+
+	// Questions allows for more than one question (QDCOUNT > 1).
+	// If set, it's used instead of the single Question above.
+	Questions []Question `yaml:"questions,omitempty"`
+
+	Resolver   Resolver `yaml:"resolver"`
+	Answers    []Answer `yaml:"answers,omitempty"`
+	Authority  []Answer `yaml:"authority,omitempty"`
+	Additional []Answer `yaml:"additional,omitempty"`
+
+	// Update, if set, turns the message into a dynamic update (RFC 2136). The zone replaces
+	// the question, the prerequisites go in the answer section and the operations in the
+	// authority section, so Question, Answers and Authority have to be left empty.
+	Update *Update `yaml:"update,omitempty"`
+
+	// Transfer controls zone transfers, which the agent performs over TCP whenever
+	// the (first) question is of type AXFR or IXFR. It can be left out to use the defaults.
+	Transfer *Transfer `yaml:"transfer,omitempty"`
+
+	// Capture, if set, makes the agent write the message to a synthetic pcap instead of
+	// sending it, e.g. to build test corpora for IDS rules and the analyzer.
+	Capture *Capture `yaml:"capture,omitempty"`
+
+	// EDNS, if set, adds an EDNS0 OPT pseudo-record to the additional section
+	EDNS *EDNS `yaml:"edns,omitempty"`
+
+	// Compression, if set, controls name compression and injects compression pointers
+	Compression *Compression `yaml:"compression,omitempty"`
+
+	// AllowViolations permits names given as labels to break the RFC 1035 limits,
+	// e.g. labels over 63 bytes, names over 255 bytes or labels containing dots and binary data.
+	AllowViolations bool `yaml:"allow_violations"`
+
+	// DNSSEC, if set, signs the answer and authority RRsets of a response with RRSIGs,
+	// and can add the DNSKEY, DS and NSEC/NSEC3 records to go with them
+	DNSSEC *DNSSEC `yaml:"dnssec,omitempty"`
+
+	// TSIG, if set, signs the packed message with a transaction signature (RFC 8945).
+	// Signing happens after the overrides and before the patches, so patches can still
+	// tamper with a signed message.
+	TSIG *TSIG `yaml:"tsig,omitempty"`
+
+	// Size, if set, controls what happens when the message doesn't fit in the UDP payload
+	// size it's sent with. Without it, messages over the limit are sent with a warning.
+	Size *SizePolicy `yaml:"size,omitempty"`
+
+	// Patches are applied to the packed message as the very last step, in the order given
+	Patches []Patch `yaml:"patches,omitempty"`
+}
+
+// AllQuestions returns the questions of the message. The single question form
+// is kept for backward compatibility and is only used when Questions is empty.
+func (r DNSRequest) AllQuestions() []Question {
+	if len(r.Questions) > 0 {
+		return r.Questions
+	}
+	return []Question{r.Question}
 }
 
 // Header represents the DNS header section.
 type Header struct {
 	// Query ID (16 bits): A random ID to match requests with replies.
+	// Unless IDStrategy says otherwise, 0 means a random ID.
 	ID uint16 `yaml:"id"`
 
+	// IDStrategy: Optional control over how IDs are picked, for reproducible runs
+	// or a series of messages that mimics a specific client's ID pattern.
+	IDStrategy *IDStrategy `yaml:"id_strategy,omitempty"`
+
 	// QR (1 bit): false means query, true means response
 	QR bool `yaml:"qr"`
 
 	// OpCode (4 bits): Specifies the kind of query.
 	OpCode string `yaml:"opcode"`
 
+	// StdOpCode: If true, use standard opcode names (QUERY, NOTIFY, etc). If false, use custom opcode value
+	StdOpCode bool `yaml:"std_opcode"`
+
+	// CustomOpCode: When StdOpCode is false, this value (0-15) is used directly,
+	// which allows for the reserved opcodes 7 - 15
+	CustomOpCode uint8 `yaml:"custom_opcode,omitempty"`
+
 	// Flags (1 bit each): These boolean flags control the behavior of the DNS query.
 	Authoritative      bool `yaml:"authoritative"`       // AA
 	Truncated          bool `yaml:"truncated"`           // TC
 	RecursionDesired   bool `yaml:"recursion_desired"`   // RD
 	RecursionAvailable bool `yaml:"recursion_available"` // RA
 
-	// Z (3 bits): Reserved bits. Per RFC 1035, this "must be zero".
+	// AD and CD (1 bit each): Two of the bits RFC 1035 reserved as Z,
+	// since taken by DNSSEC (RFC 4035).
+	AuthenticatedData bool `yaml:"authenticated_data"` // AD
+	CheckingDisabled  bool `yaml:"checking_disabled"`  // CD
+
+	// Z (1 bit): The only bit that's still reserved. Per RFC 1035, this "must be zero".
 	// We expose it to allow for non-standard values (inspired by DNS sandwich).
+	// Z used to hold all 3 bits RFC 1035 reserved (0 - 7), the lower 2 of which are now
+	// AD and CD. Configs from back then are mapped onto the new fields, see MigrateLegacyZ.
 	Z uint8 `yaml:"z"`
 
 	// RCode (4 bits): Response code. We use uint8 (0-15) to allow setting
 	// any value, including standard codes and reserved ones (11 - 15).
 	RCode uint8 `yaml:"rcode"`
+
+	// CountOverrides: Optional section counts that replace the real ones after packing,
+	// so the header can lie about the sections that are actually present.
+	CountOverrides *CountOverrides `yaml:"count_overrides,omitempty"`
+}
+
+// MigrateLegacyZ maps a Z of 2 - 7, from when Z held all 3 reserved bits, onto the bits it
+// set back then: 4 is Z, 2 is AD and 1 is CD (so the old 6 is Z and AD). It returns a warning
+// for the config's author, or "" if Z was fine as it is. Values over 7 are left for validation.
+func (h *Header) MigrateLegacyZ() string {
+	if h.Z < 2 || h.Z > 7 {
+		return ""
+	}
+
+	legacy := h.Z
+	h.Z = legacy >> 2
+	h.AuthenticatedData = h.AuthenticatedData || legacy&0x02 != 0
+	h.CheckingDisabled = h.CheckingDisabled || legacy&0x01 != 0
+	return fmt.Sprintf("header.z: %d is the old 3-bit form, taken as z: %d, authenticated_data: %t and checking_disabled: %t. "+
+		"AD and CD have fields of their own now, set those and keep z at 0 or 1", legacy, h.Z, h.AuthenticatedData, h.CheckingDisabled)
+}
+
+// UsesStdOpCode reports whether OpCode is looked up by name. Besides std_opcode, that's
+// the case for an opcode given without a custom_opcode, which would otherwise silently
+// send opcode 0 (QUERY). To send QUERY as a custom opcode, leave opcode empty.
+func (h Header) UsesStdOpCode() bool {
+	return h.StdOpCode || (h.OpCode != "" && h.CustomOpCode == 0)
+}
+
+// IDStrategy picks the ID of every message in a series (e.g. the messages from cmd/encode).
+type IDStrategy struct {
+	// Mode: How IDs are picked:
+	//   random    - random IDs, seeded with Seed if it's set (for reproducible runs)
+	//   increment - Start, Start+Step, Start+2*Step, ... (wrapping around at 65535)
+	//   list      - the IDs in List, in order, starting over at the end
+	//   constant  - Header.ID for every message, 0 included
+	Mode string `yaml:"mode"`
+
+	// Seed: random, the seed for the random number generator.
+	Seed *int64 `yaml:"seed,omitempty"`
+
+	// Start and Step: increment, Step defaults to 1.
+	Start uint16 `yaml:"start,omitempty"`
+	Step  uint16 `yaml:"step,omitempty"`
+
+	// List: list, the IDs to use.
+	List []uint16 `yaml:"list,omitempty"`
+}
+
+// CountOverrides holds the header section counts to write after packing.
+// A nil field leaves that count as miekg packed it, so 0 is a valid override.
+type CountOverrides struct {
+	QDCount *uint16 `yaml:"qdcount,omitempty"`
+	ANCount *uint16 `yaml:"ancount,omitempty"`
+	NSCount *uint16 `yaml:"nscount,omitempty"`
+	ARCount *uint16 `yaml:"arcount,omitempty"`
 }
 
 // Question represents the question section of a DNS query.
@@ -46,6 +179,13 @@ type Question struct {
 	// Type: The type of record being requested (e.g., "A", "AAAA", "MX").
 	Type string `yaml:"type"`
 
+	// StdType: If true, use standard type names (A, MX, etc). If false, use custom type value
+	StdType bool `yaml:"std_type"`
+
+	// CustomType: When StdType is false, this uint16 value is used directly,
+	// which allows for unassigned and private-use types (e.g. 65280 - 65534)
+	CustomType uint16 `yaml:"custom_type,omitempty"`
+
 	// Class: The protocol class, almost always "IN" for internet.
 	Class string `yaml:"class"`
 
@@ -54,6 +194,228 @@ type Question struct {
 
 	// CustomClass: When StdClass is false, this uint16 value is used directly
 	CustomClass uint16 `yaml:"custom_class,omitempty"`
+
+	// Labels: Alternative to Name, the labels are written byte-for-byte (see Label).
+	Labels []Label `yaml:"labels,omitempty"`
+}
+
+// UsesStdType reports whether Type is looked up by name. Besides std_type, that's the
+// case for a type given without a custom_type, which would otherwise silently send
+// TYPE 0. To send TYPE 0 on purpose, leave type empty.
+func (q Question) UsesStdType() bool {
+	return q.StdType || (q.Type != "" && q.CustomType == 0)
+}
+
+// UsesStdClass reports whether Class is looked up by name, following the same rule as UsesStdType.
+func (q Question) UsesStdClass() bool {
+	return q.StdClass || (q.Class != "" && q.CustomClass == 0)
+}
+
+// Label is a single label of a name, given as either text or hex.
+// The length byte and the terminating root label are added for us.
+type Label struct {
+	// Text: The label as-is, dots included (they don't separate labels here).
+	Text string `yaml:"text,omitempty"`
+
+	// Hex: The label as a hex string, for NUL and other binary bytes.
+	Hex string `yaml:"hex,omitempty"`
+}
+
+// EDNS represents the EDNS0 OPT pseudo-record (RFC 6891).
+// Like Header.Z, every field accepts non-standard values.
+type EDNS struct {
+	// UDPSize: The advertised UDP payload size (carried in the CLASS field).
+	UDPSize uint16 `yaml:"udp_size"`
+
+	// Version: The EDNS version, only 0 is defined.
+	Version uint8 `yaml:"version"`
+
+	// DO: The DNSSEC OK bit.
+	DO bool `yaml:"do"`
+
+	// Z (15 bits): The flag bits following DO. Per RFC 6891 these "must be zero",
+	// but we allow any value from 0 to 32767 (0x7FFF).
+	Z uint16 `yaml:"z"`
+
+	// ExtendedRCode: The upper 8 bits of the 12-bit RCODE,
+	// the lower 4 bits are taken from Header.RCode.
+	ExtendedRCode uint8 `yaml:"extended_rcode"`
+
+	// Options: The EDNS options in the order they should appear, duplicates are allowed.
+	Options []EDNSOption `yaml:"options,omitempty"`
+}
+
+// EDNSOption represents a single EDNS option.
+type EDNSOption struct {
+	// Type: The option name (see EDNSOptionMap), or "CUSTOM" to use Code directly.
+	Type string `yaml:"type"`
+
+	// Code: The raw option code, only used when Type is "CUSTOM".
+	Code uint16 `yaml:"code,omitempty"`
+
+	// Data: The option payload as a hex string. Used for NSID, CUSTOM
+	// and every other option without its own fields below.
+	Data string `yaml:"data,omitempty"`
+
+	// Family, SourceNetmask, SourceScope and Address: SUBNET (Client Subnet, RFC 7871).
+	// Family is derived from Address if left at 0.
+	Family        uint16 `yaml:"family,omitempty"`
+	SourceNetmask uint8  `yaml:"source_netmask,omitempty"`
+	SourceScope   uint8  `yaml:"source_scope,omitempty"`
+	Address       string `yaml:"address,omitempty"`
+
+	// Cookie: COOKIE, the client cookie (8 bytes) optionally followed by
+	// the server cookie, as a hex string.
+	Cookie string `yaml:"cookie,omitempty"`
+
+	// Length: PADDING, the number of zero bytes of padding.
+	Length uint16 `yaml:"length,omitempty"`
+}
+
+// Compression controls how names are compressed (RFC 1035, section 4.1.4).
+type Compression struct {
+	// Mode: "off" (the default) writes every name in full, "on" lets miekg compress names.
+	Mode string `yaml:"mode"`
+
+	// Pointers: Compression pointers written into names after packing, in the order given.
+	// These are free to be malicious, so they can only be used with Mode "off".
+	Pointers []PointerInjection `yaml:"pointers,omitempty"`
+}
+
+// PointerInjection replaces (the end of) a single question or owner name with a compression pointer.
+type PointerInjection struct {
+	// Name: The name to modify, e.g. "question[0]", "answer[1]", "authority[0]" or "additional[0]".
+	Name string `yaml:"name"`
+
+	// KeepLabels: The number of leading labels to keep, the rest of the name is replaced by the pointer.
+	KeepLabels int `yaml:"keep_labels"`
+
+	// Kind: Where the pointer points to:
+	//   name      - the start of the name given in Target, which may itself be a pointer (to build loops across names)
+	//   loop      - the pointer itself
+	//   forward   - the start of the name given in Target, which has to come after the pointer
+	//   header    - Offset into the 12-byte header
+	//   mid_label - Offset bytes into the first label of the name given in Target
+	//   offset    - the raw Offset, anywhere in the message
+	Kind string `yaml:"kind"`
+
+	// Target: The name referred to by kinds name, forward and mid_label (same form as Name).
+	Target string `yaml:"target,omitempty"`
+
+	// Offset: Used by kinds header, mid_label and offset, see above.
+	Offset uint16 `yaml:"offset,omitempty"`
+}
+
+// Patch changes the bytes of the packed message directly. It either overwrites bytes,
+// changes the bits selected by a mask, or appends bytes to the end of the message.
+type Patch struct {
+	// Anchor: The field to patch, e.g. "header.flags", "question.qtype" or "answer[0].rdlength".
+	// Section anchors without an index (e.g. "answer.ttl") refer to the first one.
+	Anchor string `yaml:"anchor,omitempty"`
+
+	// Offset: The byte offset to patch. If Anchor is set, it's relative to the start of that field.
+	Offset *uint16 `yaml:"offset,omitempty"`
+
+	// Bytes: Replacement bytes as a hex string, written from the offset (or anchor) onwards.
+	Bytes string `yaml:"bytes,omitempty"`
+
+	// Mask and Value: Hex strings of the same length, only the bits set in Mask
+	// are replaced by those in Value (e.g. mask "0070", value "0050" sets Z to 5).
+	Mask  string `yaml:"mask,omitempty"`
+	Value string `yaml:"value,omitempty"`
+
+	// Append: Bytes as a hex string, added after the end of the message (e.g. trailing garbage).
+	Append string `yaml:"append,omitempty"`
+}
+
+// DNSSEC holds the keys used to sign the records of a response, along with the
+// records to add and the kind of signatures to create.
+type DNSSEC struct {
+	// Zone: The signer's name, i.e. the zone the records belong to (e.g. "timeserversync.com.").
+	Zone string `yaml:"zone"`
+
+	// KeyFile: A BIND key pair to sign with, given as the path without the extension
+	// (e.g. "keys/Ktimeserversync.com.+013+12345" for the .key and .private files).
+	// It's read when the message is built. If empty, an ephemeral KSK and ZSK are generated.
+	KeyFile string `yaml:"key_file,omitempty"`
+
+	// Algorithm: The algorithm of the ephemeral keys: RSASHA256, RSASHA512,
+	// ECDSAP256SHA256 (the default), ECDSAP384SHA384 or ED25519.
+	Algorithm string `yaml:"algorithm,omitempty"`
+
+	// Signatures: The kind of signatures to create:
+	//   valid         - valid from an hour ago until Validity from now (the default)
+	//   expired       - expired an hour ago
+	//   not_yet_valid - only valid from a day from now
+	//   mismatched    - valid in time, but the signature doesn't match the RRset
+	Signatures string `yaml:"signatures,omitempty"`
+
+	// Validity: The number of seconds a signature is valid for. Defaults to 14 days.
+	Validity uint32 `yaml:"validity,omitempty"`
+
+	// DNSKEY: If true, the DNSKEY RRset (signed by the KSK) is added to the answer section.
+	DNSKEY bool `yaml:"dnskey"`
+
+	// DS: If true, the DS record of the KSK (SHA-256 digest) is added to the authority section.
+	DS bool `yaml:"ds"`
+
+	// Denial: nsec or nsec3 adds a record to the authority section that claims no
+	// names exist between the question name and NextName, with the types of the
+	// answer records at the question name.
+	Denial string `yaml:"denial,omitempty"`
+
+	// NextName: The next name in the zone for Denial. Defaults to the name right after the question
+	// name, for nsec3 the hash right after the question name's hash (it's hashed otherwise).
+	NextName string `yaml:"next_name,omitempty"`
+
+	// NSEC3Iterations and NSEC3Salt (hex): The hash parameters for Denial nsec3.
+	NSEC3Iterations uint16 `yaml:"nsec3_iterations,omitempty"`
+	NSEC3Salt       string `yaml:"nsec3_salt,omitempty"`
+}
+
+// TSIG holds the key used to sign the message, along with knobs to deliberately
+// produce signatures a server should reject.
+type TSIG struct {
+	// KeyName: The name of the key, as configured on the server (e.g. "transfer-key").
+	KeyName string `yaml:"key_name"`
+
+	// Algorithm: hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512.
+	Algorithm string `yaml:"algorithm"`
+
+	// Secret: The shared secret, base64 encoded (as in BIND's and Knot's key files).
+	Secret string `yaml:"secret"`
+
+	// Fudge: The number of seconds the time signed may be off by. Defaults to 300.
+	Fudge uint16 `yaml:"fudge,omitempty"`
+
+	// TimeSigned: Seconds since the epoch to sign with. Defaults to the current time.
+	TimeSigned uint64 `yaml:"time_signed,omitempty"`
+
+	// TimeSkew: Seconds added to the time signed (may be negative), to end up outside the fudge.
+	TimeSkew int64 `yaml:"time_skew,omitempty"`
+
+	// RequestMAC: Hex string of the request's MAC, to sign a response to a signed request.
+	RequestMAC string `yaml:"request_mac,omitempty"`
+
+	// BadMAC: If true, the MAC is corrupted after signing.
+	BadMAC bool `yaml:"bad_mac"`
+
+	// WrongKeyName: If set, the message is signed with KeyName, but the record carries this name.
+	WrongKeyName string `yaml:"wrong_key_name,omitempty"`
+}
+
+// SizePolicy holds what to do with a message larger than the UDP payload size limit.
+type SizePolicy struct {
+	// Policy: One of
+	//   strict   - drop records from the end until the message fits, and set TC if any answer or
+	//              authority records had to go, like a real server (responses only)
+	//   warn     - send the message as-is, with a warning if it's over the limit (the default)
+	//   oversize - send the message as-is, it's meant to be over the limit
+	Policy string `yaml:"policy"`
+
+	// Limit: The limit in bytes. Defaults to 65535 over TCP, the EDNS udp_size if there is one
+	// (but at least 512), and the classic 512 bytes otherwise.
+	Limit int `yaml:"limit,omitempty"`
 }
 
 // Resolver holds the information about the DNS resolver we're sending the packet to.
@@ -65,15 +427,247 @@ type Resolver struct {
 	// if UseSystemDefaults is false we can manually set the server/resolver here
 	IP   string `yaml:"ip"`
 	Port int    `yaml:"port"`
+
+	// Transport: udp (the default) or tcp. Over TCP, every message is prefixed by its
+	// length (RFC 1035, section 4.2.2) and responses can be as large as 65535 bytes.
+	Transport string `yaml:"transport,omitempty"`
+
+	// TCP: Optional knobs for the tcp transport, to send what a well-behaved client wouldn't.
+	TCP *TCPOptions `yaml:"tcp,omitempty"`
+}
+
+// TCPOptions holds the knobs of the tcp transport. Each applies to every message sent.
+type TCPOptions struct {
+	// LengthPrefix: If set, this value is sent as the length prefix instead of the real length.
+	LengthPrefix *uint16 `yaml:"length_prefix,omitempty"`
+
+	// LengthDelta: Added to the real length to get the prefix (e.g. -2 or 10), if LengthPrefix isn't set.
+	LengthDelta int `yaml:"length_delta,omitempty"`
+
+	// Segments: Split every (prefixed) message into TCP segments of these sizes in bytes,
+	// with whatever is left in a last segment. E.g. [2] sends the length prefix on its own, [1] splits it.
+	Segments []int `yaml:"segments,omitempty"`
+
+	// SegmentDelay: Milliseconds to wait between segments, so they aren't coalesced. Defaults to 10.
+	SegmentDelay int `yaml:"segment_delay,omitempty"`
+
+	// Pipeline: The number of queries to send on the one connection before reading the
+	// responses (RFC 7766). Every query after the first is crafted again, with the next ID
+	// of the ID strategy and its placeholders expanded again. Defaults to 1.
+	Pipeline int `yaml:"pipeline,omitempty"`
 }
 
-// Answer represents a DNS answer record
+// Answer represents a DNS resource record. Despite the name it's used for
+// the records in the answer, authority and additional sections alike.
 type Answer struct {
-	Name  string `yaml:"name"`
-	Type  string `yaml:"type"`
-	Class string `yaml:"class"`
-	TTL   uint32 `yaml:"ttl"`
-	Data  string `yaml:"data"` // For TXT records, this will be the text content
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+
+	// Class, StdClass and CustomClass work just like they do for Question.
+	// With StdClass, Class may also use the generic "CLASSnnn" form (e.g. "CLASS300").
+	Class       string `yaml:"class"`
+	StdClass    bool   `yaml:"std_class"`
+	CustomClass uint16 `yaml:"custom_class,omitempty"`
+
+	// CacheFlush: Sets the top bit of the CLASS field, which mDNS (RFC 6762)
+	// uses as the cache-flush flag. Works with both standard and custom classes.
+	CacheFlush bool `yaml:"cache_flush"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	// Data: For TXT records, this will be the text content, which is split into
+	// character-strings of up to 255 bytes (see TXT for more control).
+	// For every other type it holds the RDATA in zone-file presentation
+	// format, e.g. "10 mail.vuilhond.com." for an MX record.
+	Data string `yaml:"data"`
+
+	// TXT: Optional control over how TXT data is split into strings and records.
+	TXT *TXTOptions `yaml:"txt,omitempty"`
+
+	// RData: Structured alternative to Data for the common record types.
+	// If set, it takes precedence over Data.
+	RData *RData `yaml:"rdata,omitempty"`
+
+	// TypeCode: Numeric record type, used instead of Type when non-zero.
+	// This allows for private-use and unassigned types (e.g. 65280 - 65534).
+	// It requires RawRData.
+	TypeCode uint16 `yaml:"type_code,omitempty"`
+
+	// RawRData: RDATA in RFC 3597 generic encoding, e.g. `\# 4 c0000201`.
+	// If set, it takes precedence over RData and Data and is written as-is.
+	RawRData string `yaml:"raw_rdata,omitempty"`
+
+	// Labels: Alternative to Name, the owner name is written byte-for-byte (see Label).
+	Labels []Label `yaml:"labels,omitempty"`
+}
+
+// UsesStdClass reports whether Class is looked up by name. Besides std_class, that's
+// the case for a class given without a custom_class, which would otherwise silently
+// send CLASS 0. To send CLASS 0 on purpose, leave class empty.
+func (a Answer) UsesStdClass() bool {
+	return a.StdClass || (a.Class != "" && a.CustomClass == 0)
+}
+
+// Transfer holds the options of a zone transfer (AXFR or IXFR).
+type Transfer struct {
+	// Output: The file the received zone is written to, in zone-file format.
+	// For an IXFR, that's the records as received, i.e. the differences. Defaults to "transfer.zone".
+	Output string `yaml:"output,omitempty"`
+
+	// Timeout: The number of seconds to wait for every message of the transfer. Defaults to 10.
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// Capture holds the options of writing the message to a synthetic capture. The message is
+// wrapped in Ethernet, IPv4 or IPv6 and UDP headers: a query goes from the client to the
+// server, a response from the server to the client.
+type Capture struct {
+	// Output: The file to write. Defaults to "spinnekop.pcap".
+	Output string `yaml:"output,omitempty"`
+
+	// Format: pcap or pcapng. Defaults to pcapng if Output ends in .pcapng, and pcap otherwise.
+	Format string `yaml:"format,omitempty"`
+
+	// Append: If true, the packets are added to Output if it exists, instead of overwriting it.
+	Append bool `yaml:"append"`
+
+	// ClientIP and ServerIP: Both IPv4 or both IPv6. The client defaults to 192.0.2.10, the
+	// server to the resolver's IP (or 192.0.2.53 if the system's resolver is used).
+	ClientIP string `yaml:"client_ip,omitempty"`
+	ServerIP string `yaml:"server_ip,omitempty"`
+
+	// ClientPort and ServerPort: The client defaults to 49152, the server to the resolver's port (or 53).
+	ClientPort int `yaml:"client_port,omitempty"`
+	ServerPort int `yaml:"server_port,omitempty"`
+
+	// ClientMAC and ServerMAC: Default to 02:00:00:00:00:01 and 02:00:00:00:00:02.
+	ClientMAC string `yaml:"client_mac,omitempty"`
+	ServerMAC string `yaml:"server_mac,omitempty"`
+
+	// Timestamp: The time of the (first) packet, in RFC 3339 format (e.g. "2025-01-01T12:00:00Z").
+	// Defaults to the current time.
+	Timestamp string `yaml:"timestamp,omitempty"`
+
+	// IncludeQuery: For a response, also write the query it answers (same ID, opcode, questions
+	// and EDNS, unsigned) before it, so the pair forms a complete exchange.
+	IncludeQuery bool `yaml:"include_query"`
+
+	// ResponseDelay: Milliseconds between the query and the response, with IncludeQuery. Defaults to 10.
+	ResponseDelay int `yaml:"response_delay,omitempty"`
+}
+
+// Update holds the sections of a dynamic update (RFC 2136). Header.OpCode should be UPDATE,
+// unless the point is to send update sections with another opcode.
+type Update struct {
+	// Zone: The zone to update, sent as the zone section ("<zone> SOA <class>").
+	Zone string `yaml:"zone"`
+
+	// Class: The class of the zone (IN, CH, HS, NONE or ANY). Defaults to IN.
+	Class string `yaml:"class,omitempty"`
+
+	// Prerequisites: Conditions the server checks before applying any operation.
+	Prerequisites []UpdatePrerequisite `yaml:"prerequisites,omitempty"`
+
+	// Operations: The records to add and delete, in order.
+	Operations []UpdateOperation `yaml:"operations,omitempty"`
+}
+
+// UpdatePrerequisite is a single prerequisite of an update (RFC 2136, section 2.4).
+type UpdatePrerequisite struct {
+	// Condition: One of:
+	//   rrset_exists       - an RRset of Type exists at Name, whatever its value
+	//   rrset_exists_value - an RRset of Type exists at Name, with exactly this record (Data or RData)
+	//   rrset_not_exists   - no RRset of Type exists at Name
+	//   name_in_use        - Name has at least one record, of any type
+	//   name_not_in_use    - Name has no records at all
+	Condition string `yaml:"condition"`
+
+	Name string `yaml:"name"`
+
+	// Type: The type of the RRset, not used by name_in_use and name_not_in_use.
+	Type string `yaml:"type,omitempty"`
+
+	// Data and RData: The record for rrset_exists_value, just like they are for Answer.
+	Data  string `yaml:"data,omitempty"`
+	RData *RData `yaml:"rdata,omitempty"`
+}
+
+// UpdateOperation is a single operation of an update (RFC 2136, section 2.5).
+type UpdateOperation struct {
+	// Action: One of:
+	//   add          - add the record (Data or RData) to the RRset of Type at Name
+	//   delete_rrset - delete the RRset of Type at Name
+	//   delete_name  - delete every RRset at Name
+	//   delete       - delete the record (Data or RData) from the RRset of Type at Name
+	Action string `yaml:"action"`
+
+	Name string `yaml:"name"`
+
+	// Type: The type of the record or RRset, not used by delete_name.
+	Type string `yaml:"type,omitempty"`
+
+	// TTL: add, the TTL of the new record.
+	TTL uint32 `yaml:"ttl,omitempty"`
+
+	// Data and RData: The record for add and delete, just like they are for Answer.
+	Data  string `yaml:"data,omitempty"`
+	RData *RData `yaml:"rdata,omitempty"`
+}
+
+// TXTOptions controls how the data of a TXT record is packed. The data is cut into
+// chunks, one per character-string, and the strings are spread over one or more TXT records.
+type TXTOptions struct {
+	// ChunkSize: The length of every string (1 - 255), only the last one can be shorter. Defaults to 255.
+	// It counts bytes on the wire, so an escape in the data (e.g. \DDD or \") counts as one.
+	ChunkSize int `yaml:"chunk_size,omitempty"`
+
+	// MaxStrings: The maximum number of strings per record, 0 means no limit.
+	MaxStrings int `yaml:"max_strings,omitempty"`
+
+	// Records: The number of TXT records to spread the strings over, as evenly as possible.
+	// 0 means as many as needed given MaxStrings. Records left without data hold a single empty string.
+	Records int `yaml:"records,omitempty"`
+}
+
+// RData holds the structured RDATA fields of a record.
+// Only the fields that belong to the record's Type are used.
+type RData struct {
+	// Address: A and AAAA
+	Address string `yaml:"address,omitempty"`
+
+	// Target: CNAME, NS, PTR, MX (exchange), SRV and HTTPS (target name)
+	Target string `yaml:"target,omitempty"`
+
+	// Preference: MX
+	Preference uint16 `yaml:"preference,omitempty"`
+
+	// Priority: SRV and HTTPS (SvcPriority, 0 means alias mode)
+	Priority uint16 `yaml:"priority,omitempty"`
+
+	// Weight and Port: SRV
+	Weight uint16 `yaml:"weight,omitempty"`
+	Port   uint16 `yaml:"port,omitempty"`
+
+	// MName, RName, Serial, Refresh, Retry, Expire and Minimum: SOA
+	MName   string `yaml:"mname,omitempty"`
+	RName   string `yaml:"rname,omitempty"`
+	Serial  uint32 `yaml:"serial,omitempty"`
+	Refresh uint32 `yaml:"refresh,omitempty"`
+	Retry   uint32 `yaml:"retry,omitempty"`
+	Expire  uint32 `yaml:"expire,omitempty"`
+	Minimum uint32 `yaml:"minimum,omitempty"`
+
+	// Flag, Tag and Value: CAA (e.g. 0 issue "letsencrypt.org")
+	Flag  uint8  `yaml:"flag,omitempty"`
+	Tag   string `yaml:"tag,omitempty"`
+	Value string `yaml:"value,omitempty"`
+
+	// Hex: NULL, the raw RDATA bytes as a hex string
+	Hex string `yaml:"hex,omitempty"`
+
+	// Params: HTTPS, the SvcParams in presentation format
+	// (e.g. `alpn="h2,h3" ipv4hint=192.0.2.1`)
+	Params string `yaml:"params,omitempty"`
 }
 
 // RDATAAnalysis is for info related to TXT response RDATA analysis
@@ -90,7 +684,11 @@ type DNSPacket struct {
 	Type          string // "Request" or "Response"
 	RawData       []byte
 	Msg           *dns.Msg // Parsed miekg msg object
-	ZValue        uint8
-	RecordType    string // DNS record type (A, MX, CNAME, etc.)
+	ZValue        uint8    // The reserved Z bit, AD and CD are not included
+	RecordType    string   // DNS record type (A, MX, CNAME, etc.)
 	RDATAAnalysis *RDATAAnalysis
+
+	ParseError       string   // Set if miekg could not (fully) unpack the message
+	CountMismatches  []string // Header counts that don't match the sections present
+	PointerAnomalies []string // Compression pointers a well-behaved server would never produce
 }
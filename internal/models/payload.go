@@ -0,0 +1,54 @@
+package models
+
+// PayloadOptions controls how a payload (e.g. a file) is encoded into a series of DNS messages.
+type PayloadOptions struct {
+	// Placement: Where the payload goes:
+	//   subdomain - in the labels of the question name, one query per chunk
+	//   txt       - in the data of a TXT answer, one response per chunk
+	//   null      - in the RDATA of a NULL answer, one response per chunk
+	Placement string `yaml:"placement"`
+
+	// Encoding: How the payload is encoded: hex, base32, base64 or base64url.
+	Encoding string `yaml:"encoding"`
+
+	// Domain: The domain the chunks are sent under, e.g. "timeserversync.com".
+	Domain string `yaml:"domain"`
+
+	// LabelSize: subdomain, the maximum number of characters per label (1 - 63). Defaults to 63.
+	LabelSize int `yaml:"label_size,omitempty"`
+
+	// ChunkSize: The number of encoded characters per message. Defaults to as many as fit
+	// in a name for subdomain, and 255 (a single TXT string) for txt and null.
+	ChunkSize int `yaml:"chunk_size,omitempty"`
+}
+
+// PayloadManifest describes how a payload was split over messages, so it can be
+// reassembled (and verified) from the chunks.
+type PayloadManifest struct {
+	Placement string `yaml:"placement"`
+	Encoding  string `yaml:"encoding"`
+	Domain    string `yaml:"domain"`
+
+	// Size and SHA256: The size and hash of the original payload
+	Size   int    `yaml:"size"`
+	SHA256 string `yaml:"sha256"`
+
+	Chunks []PayloadChunk `yaml:"chunks"`
+}
+
+// PayloadChunk is a single chunk of an encoded payload, carried by a single message.
+type PayloadChunk struct {
+	// Sequence: The position of the chunk, starting at 0. It's also the label of Name right
+	// before the domain: Name is "<sequence>.<domain>", or "<chunk labels>.<sequence>.<domain>"
+	// for subdomain placement.
+	Sequence int `yaml:"sequence"`
+
+	// Name: The question name of the message carrying the chunk.
+	Name string `yaml:"name"`
+
+	// Data: The encoded chunk.
+	Data string `yaml:"data"`
+
+	// File: The config file the message was written to, if any.
+	File string `yaml:"file,omitempty"`
+}
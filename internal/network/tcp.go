@@ -0,0 +1,122 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"net"
+	"slices"
+	"time"
+)
+
+const (
+	// tcpTimeout is how long we wait to connect, and for every response
+	tcpTimeout = 5 * time.Second
+
+	defaultSegmentDelay = 10 * time.Millisecond
+)
+
+// SendAndReceiveTCP sends raw DNS packets to a resolver over a single TCP connection, each
+// prefixed by its length (RFC 1035, section 4.2.2), and reads a response for every one of them.
+// All packets are sent before any response is read, so more than one is a pipeline (RFC 7766).
+// The tcp options of the resolver can make the prefix lie about the length, and split the
+// packets across several segments. The responses are returned in the order they came in,
+// which for a pipeline doesn't have to be the order of the queries. If not all of them
+// arrive, the ones that did are returned along with the error.
+func SendAndReceiveTCP(packets [][]byte, resolver models.Resolver) ([][]byte, error) {
+	options := models.TCPOptions{}
+	if resolver.TCP != nil {
+		options = *resolver.TCP
+	}
+
+	// Combine IP and Port
+	address := net.JoinHostPort(resolver.IP, fmt.Sprint(resolver.Port))
+
+	conn, err := net.DialTimeout("tcp", address, tcpTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to resolver: %w", err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("\n🚀 Sending %d packet(s) to %s over TCP\n", len(packets), address)
+
+	for i, packet := range packets {
+		prefixed, err := prefixTCPMessage(packet, options)
+		if err != nil {
+			return nil, fmt.Errorf("packet %d: %w", i, err)
+		}
+		if err := writeSegments(conn, prefixed, options); err != nil {
+			return nil, fmt.Errorf("failed to send packet %d: %w", i, err)
+		}
+	}
+	fmt.Println("✅  Packet(s) sent successfully.")
+
+	var responses [][]byte
+	for len(responses) < len(packets) {
+		if err := conn.SetReadDeadline(time.Now().Add(tcpTimeout)); err != nil {
+			return responses, fmt.Errorf("failed to set read deadline: %w", err)
+		}
+
+		response, err := readTCPMessage(conn)
+		if err != nil {
+			return responses, fmt.Errorf("failed to read response %d of %d: %w", len(responses)+1, len(packets), err)
+		}
+		fmt.Printf("🫴 Received %d bytes.\n", len(response))
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// prefixTCPMessage puts the length prefix in front of the packet, which is the real length
+// unless the options say otherwise.
+func prefixTCPMessage(packet []byte, options models.TCPOptions) ([]byte, error) {
+	if len(packet) > dns.MaxMsgSize {
+		return nil, fmt.Errorf("packet of %d bytes is too large for TCP (max %d)", len(packet), dns.MaxMsgSize)
+	}
+
+	length := len(packet) + options.LengthDelta
+	if options.LengthPrefix != nil {
+		length = int(*options.LengthPrefix)
+	}
+	if length < 0 || length > dns.MaxMsgSize {
+		return nil, fmt.Errorf("length prefix %d (%d bytes %+d) does not fit in 16 bits", length, len(packet), options.LengthDelta)
+	}
+	if length != len(packet) {
+		fmt.Printf("⚠️  Length prefix says %d bytes, the packet is %d bytes\n", length, len(packet))
+	}
+
+	prefixed := binary.BigEndian.AppendUint16(nil, uint16(length))
+	return append(prefixed, packet...), nil
+}
+
+// writeSegments writes data in segments of the sizes in the options, waiting after each one so
+// they go out separately (Go disables Nagle's algorithm, so every write is sent right away).
+// That includes the last one, which would otherwise be coalesced with the next message.
+func writeSegments(conn net.Conn, data []byte, options models.TCPOptions) error {
+	if len(options.Segments) == 0 {
+		_, err := conn.Write(data)
+		return err
+	}
+
+	delay := defaultSegmentDelay
+	if options.SegmentDelay > 0 {
+		delay = time.Duration(options.SegmentDelay) * time.Millisecond
+	}
+
+	// Whatever the sizes leave goes in a last segment
+	sizes := append(slices.Clone(options.Segments), len(data))
+	for _, size := range sizes {
+		if len(data) == 0 {
+			break
+		}
+		size = min(size, len(data))
+		if _, err := conn.Write(data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+		time.Sleep(delay)
+	}
+	return nil
+}
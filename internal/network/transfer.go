@@ -0,0 +1,191 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// IsTransfer reports whether the message asks for a zone transfer (AXFR or IXFR).
+func IsTransfer(msg *dns.Msg) bool {
+	if len(msg.Question) == 0 {
+		return false
+	}
+	qType := msg.Question[0].Qtype
+	return qType == dns.TypeAXFR || qType == dns.TypeIXFR
+}
+
+// TransferZone sends a raw AXFR or IXFR query to a server over TCP and reads the
+// transfer stream that follows. Every message on TCP is prefixed by its length
+// (RFC 1035, section 4.2.2), and a transfer can span any number of messages,
+// so we keep reading until the closing SOA record shows up.
+// query is the message packet was packed from, it tells us the transfer type and, for an IXFR,
+// the serial we claim to have (the SOA in the authority section).
+// It returns every message received, along with all their answer records in order.
+func TransferZone(packet []byte, query *dns.Msg, resolver models.Resolver, timeout time.Duration) ([]*dns.Msg, []dns.RR, error) {
+	stream := newTransferStream(query)
+	qType := stream.qType
+
+	// Combine IP and Port
+	address := net.JoinHostPort(resolver.IP, fmt.Sprint(resolver.Port))
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("\n🚀 Requesting %s from %s over TCP\n", dns.TypeToString[qType], address)
+
+	// Send the query, prefixed by its length
+	if len(packet) > dns.MaxMsgSize {
+		return nil, nil, fmt.Errorf("packet of %d bytes is too large for TCP (max %d)", len(packet), dns.MaxMsgSize)
+	}
+	prefixed := binary.BigEndian.AppendUint16(nil, uint16(len(packet)))
+	if _, err := conn.Write(append(prefixed, packet...)); err != nil {
+		return nil, nil, fmt.Errorf("failed to send packet: %w", err)
+	}
+	fmt.Println("✅  Packet sent successfully.")
+
+	var msgs []*dns.Msg
+	var records []dns.RR
+
+	for !stream.done {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return msgs, records, fmt.Errorf("failed to set read deadline: %w", err)
+		}
+
+		raw, err := readTCPMessage(conn)
+		if err != nil {
+			return msgs, records, fmt.Errorf("transfer ended early after %d message(s): %w", len(msgs), err)
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(raw); err != nil {
+			return msgs, records, fmt.Errorf("failed to unpack message %d: %w", len(msgs), err)
+		}
+		msgs = append(msgs, msg)
+
+		if msg.Rcode != dns.RcodeSuccess {
+			return msgs, records, fmt.Errorf("server refused the transfer: %s", dns.RcodeToString[msg.Rcode])
+		}
+
+		records = append(records, msg.Answer...)
+		if err := stream.add(msg); err != nil {
+			return msgs, records, err
+		}
+	}
+
+	fmt.Printf("🫴 Received %d record(s) in %d message(s).\n", len(records), len(msgs))
+
+	return msgs, records, nil
+}
+
+// readTCPMessage reads a single length-prefixed message from a TCP connection.
+func readTCPMessage(conn net.Conn) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// transferStream keeps track of the SOA records in a transfer, to tell when it's complete.
+// An AXFR (or an IXFR the server answers with the full zone) starts and ends with the
+// zone's SOA. An incremental IXFR starts with the new SOA, followed by a sequence of
+// differences that each start with an SOA, the last of which adds the new SOA again,
+// before the closing new SOA. An IXFR for a zone that's up to date is just the SOA.
+type transferStream struct {
+	qType        uint16
+	clientSerial *uint32 // IXFR, the serial from the SOA in the query's authority section
+	serial       uint32  // Serial of the first SOA
+	records      int     // Records seen so far
+	incremental  bool    // Whether the second record is an SOA as well (IXFR only)
+	seen         int     // SOA records with serial seen so far
+	done         bool
+}
+
+func newTransferStream(query *dns.Msg) *transferStream {
+	s := &transferStream{qType: query.Question[0].Qtype}
+	if s.qType == dns.TypeIXFR {
+		for _, rr := range query.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				s.clientSerial = &soa.Serial
+				break
+			}
+		}
+	}
+	return s
+}
+
+// add processes the answer records of the next message of the transfer.
+func (s *transferStream) add(msg *dns.Msg) error {
+	first := s.records == 0
+
+	for _, rr := range msg.Answer {
+		soa, isSOA := rr.(*dns.SOA)
+
+		switch s.records {
+		case 0:
+			if !isSOA {
+				return fmt.Errorf("transfer doesn't start with an SOA record, but with %s", dns.TypeToString[rr.Header().Rrtype])
+			}
+			s.serial = soa.Serial
+		case 1:
+			s.incremental = isSOA && s.qType == dns.TypeIXFR && soa.Serial != s.serial
+		}
+		s.records++
+
+		if isSOA && soa.Serial == s.serial {
+			s.seen++
+		}
+	}
+
+	closing := 2
+	if s.incremental {
+		closing = 3
+	}
+	s.done = s.seen >= closing
+
+	// An IXFR for a zone that's up to date is answered with just the SOA, which we can tell
+	// by the serial we sent. Without one, the server has nothing to compare against, so it
+	// sends the full zone (or an error), and we rely on the SOA count and the read timeout.
+	// Serials wrap around, so they're compared using serial number arithmetic (RFC 1982):
+	// the server's serial isn't newer than ours if the difference, taken as a signed
+	// 32-bit number, is 0 or negative (so 5 is newer than 4294967295).
+	if s.qType == dns.TypeIXFR && first && s.clientSerial != nil {
+		s.done = s.done || int32(s.serial-*s.clientSerial) <= 0
+	}
+
+	return nil
+}
+
+// WriteZoneFile writes the records of a transfer to a file in zone-file format.
+func WriteZoneFile(path string, zone string, qType uint16, records []dns.RR) error {
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("; %s of %s, received %s\n", dns.TypeToString[qType], zone, time.Now().UTC().Format(time.RFC3339)))
+	if qType == dns.TypeIXFR {
+		b.WriteString("; After the first SOA, the records following an old SOA are deleted and those following a new SOA are added\n")
+	}
+	for _, rr := range records {
+		b.WriteString(rr.String())
+		b.WriteString("\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write zone file '%s': %w", path, err)
+	}
+	return nil
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"github.com/faanross/spinnekop/internal/analyzer"
 	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/miekg/dns"
+	"strings"
 )
 
 // ExtractDNSPackets is used to extract DNS packets from a pcap for our analyzer
@@ -22,10 +24,7 @@ func ExtractDNSPackets(pcapFile string) ([]models.DNSPacket, error) {
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
 
 	for packet := range packetSource.Packets() {
-		if dnsLayer := packet.Layer(layers.LayerTypeDNS); dnsLayer != nil {
-			dnsLayerContent := dnsLayer.LayerContents()
-			dnsPacket := dnsLayer.(*layers.DNS)
-
+		if dnsLayerContent := dnsPayload(packet); dnsLayerContent != nil {
 			var srcIP, dstIP string
 			if ipLayer := packet.Layer(layers.LayerTypeIPv4); ipLayer != nil {
 				ip := ipLayer.(*layers.IPv4)
@@ -37,85 +36,168 @@ func ExtractDNSPackets(pcapFile string) ([]models.DNSPacket, error) {
 				dstIP = ip.DstIP.String()
 			}
 
+			// QR is the top bit of the flags (byte 2 of the DNS header)
 			pktType := "Request"
-			if dnsPacket.QR {
+			if len(dnsLayerContent) >= 3 && dnsLayerContent[2]&0x80 != 0 {
 				pktType = "Response"
 			}
 
 			// Extract actual Z value from raw packet
 			var zValue uint8
 			if len(dnsLayerContent) >= 4 {
-				// Z field is bits 9-11 of the flags (second 16-bit word)
+				// Z is bit 9 of the flags (second 16-bit word)
 				// Flags are in bytes 2-3 of the DNS header
 				flags := uint16(dnsLayerContent[2])<<8 | uint16(dnsLayerContent[3])
-				// Z is bits 6-4 of the second byte (when counting from MSB)
-				// Which is bits 9-11 of the 16-bit flags field
-				zValue = uint8((flags >> 4) & 0x07)
+				// Z is bit 6 of the 16-bit flags field, bits 5 and 4 (once also Z)
+				// are AD and CD, which are perfectly normal in DNSSEC traffic
+				zValue = uint8((flags >> 6) & 0x01)
 			}
 
 			// Pre-parse the DNS message
+			// If miekg can't fully unpack it (e.g. because the header counts lie) we keep
+			// the packet along with whatever was parsed, since those are the ones we're after
 			msg := new(dns.Msg)
 			var recordType string = "Unknown"
+			var parseError string
 
-			if err := msg.Unpack(dnsLayerContent); err == nil {
-				// Extract record type based on packet type
-				if pktType == "Request" {
-					// For requests, get the type from the question section
-					if len(msg.Question) > 0 {
-						recordType = dns.TypeToString[msg.Question[0].Qtype]
-					}
-				} else {
-					// For responses, get the type from the first answer record
-					// If no answer records, fall back to question section
-					if len(msg.Answer) > 0 {
-						recordType = dns.TypeToString[msg.Answer[0].Header().Rrtype]
-					} else if len(msg.Question) > 0 {
-						recordType = dns.TypeToString[msg.Question[0].Qtype]
+			if err := msg.Unpack(dnsLayerContent); err != nil {
+				parseError = err.Error()
+			}
+
+			// Extract record type based on packet type
+			if pktType == "Request" {
+				// For requests, get the type from the question section
+				// If there are multiple questions, list all their types (e.g. "A,MX")
+				if len(msg.Question) > 0 {
+					var qTypes []string
+					for _, q := range msg.Question {
+						qTypes = append(qTypes, dns.Type(q.Qtype).String())
 					}
+					recordType = strings.Join(qTypes, ",")
+				}
+			} else {
+				// For responses, get the type from the first answer record
+				// If no answer records, fall back to question section
+				// Type.String() falls back to the generic "TYPEnnn" form for unknown types
+				if len(msg.Answer) > 0 {
+					recordType = dns.Type(msg.Answer[0].Header().Rrtype).String()
+				} else if len(msg.Question) > 0 {
+					recordType = dns.Type(msg.Question[0].Qtype).String()
 				}
+			}
 
-				// Do RDATA analysis on response TXT sections
-				var rdataAnalysis *models.RDATAAnalysis
+			// Do RDATA analysis on response TXT sections
+			var rdataAnalysis *models.RDATAAnalysis
 
-				if pktType == "Response" && len(msg.Answer) > 0 {
-					// Debug: Print what we're analyzing
-					fmt.Printf("DEBUG: Analyzing response with %d answers\n", len(msg.Answer))
+			if pktType == "Response" && len(msg.Answer) > 0 {
+				// Debug: Print what we're analyzing
+				fmt.Printf("DEBUG: Analyzing response with %d answers\n", len(msg.Answer))
 
-					// Analyze first TXT record in answers
-					for i, answer := range msg.Answer {
-						fmt.Printf("DEBUG: Answer %d type: %s\n", i, dns.TypeToString[answer.Header().Rrtype])
+				// Analyze first TXT record in answers
+				for i, answer := range msg.Answer {
+					fmt.Printf("DEBUG: Answer %d type: %s\n", i, dns.TypeToString[answer.Header().Rrtype])
 
-						if analysis := analyzer.AnalyzeRDATA(answer); analysis != nil {
-							fmt.Printf("DEBUG: Analysis found! Hex: %v, Base64: %v, Capacity: %.2f%%\n",
-								analysis.HexDetected, analysis.Base64Detected, analysis.Capacity)
+					if analysis := analyzer.AnalyzeRDATA(answer); analysis != nil {
+						fmt.Printf("DEBUG: Analysis found! Hex: %v, Base64: %v, Capacity: %.2f%%\n",
+							analysis.HexDetected, analysis.Base64Detected, analysis.Capacity)
 
-							rdataAnalysis = &models.RDATAAnalysis{
-								HexDetected:    analysis.HexDetected,
-								Base64Detected: analysis.Base64Detected,
-								Capacity:       analysis.Capacity,
-							}
-							break // Analyze only the first TXT record
+						rdataAnalysis = &models.RDATAAnalysis{
+							HexDetected:    analysis.HexDetected,
+							Base64Detected: analysis.Base64Detected,
+							Capacity:       analysis.Capacity,
 						}
-					}
-
-					if rdataAnalysis == nil {
-						fmt.Printf("DEBUG: No TXT records found for analysis\n")
+						break // Analyze only the first TXT record
 					}
 				}
 
-				dnsPackets = append(dnsPackets, models.DNSPacket{
-					SrcIP:         srcIP,
-					DstIP:         dstIP,
-					Type:          pktType,
-					RecordType:    recordType,
-					RawData:       dnsLayerContent,
-					Msg:           msg,
-					ZValue:        zValue,
-					RDATAAnalysis: rdataAnalysis,
-				})
+				if rdataAnalysis == nil {
+					fmt.Printf("DEBUG: No TXT records found for analysis\n")
+				}
 			}
+
+			dnsPackets = append(dnsPackets, models.DNSPacket{
+				SrcIP:            srcIP,
+				DstIP:            dstIP,
+				Type:             pktType,
+				RecordType:       recordType,
+				RawData:          dnsLayerContent,
+				Msg:              msg,
+				ZValue:           zValue,
+				RDATAAnalysis:    rdataAnalysis,
+				ParseError:       parseError,
+				CountMismatches:  countMismatches(dnsLayerContent),
+				PointerAnomalies: pointerAnomalies(dnsLayerContent),
+			})
 		}
 	}
 
 	return dnsPackets, nil
 }
+
+// ExtractFrame returns the raw DNS message carried by a single frame of a pcap,
+// numbered from 1 like Wireshark does.
+func ExtractFrame(pcapFile string, frame int) ([]byte, error) {
+	if frame < 1 {
+		return nil, fmt.Errorf("frame numbers start at 1, but got %d", frame)
+	}
+
+	handle, err := pcap.OpenOffline(pcapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+
+	n := 0
+	for packet := range packetSource.Packets() {
+		n++
+		if n < frame {
+			continue
+		}
+
+		raw := dnsPayload(packet)
+		if raw == nil {
+			return nil, fmt.Errorf("frame %d does not carry a DNS message over UDP", frame)
+		}
+		return raw, nil
+	}
+
+	return nil, fmt.Errorf("the capture only has %d frame(s), there is no frame %d", n, frame)
+}
+
+// dnsPayload returns the raw DNS message carried by the packet, or nil if there is none.
+func dnsPayload(packet gopacket.Packet) []byte {
+	if dnsLayer := packet.Layer(layers.LayerTypeDNS); dnsLayer != nil {
+		return dnsLayer.LayerContents()
+	}
+
+	// gopacket refuses to decode malformed DNS (e.g. lying counts or bad pointers),
+	// so for port 53 we fall back to the raw UDP payload
+	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp := udpLayer.(*layers.UDP)
+		if (udp.SrcPort == 53 || udp.DstPort == 53) && len(udp.Payload) > 0 {
+			return udp.Payload
+		}
+	}
+
+	return nil
+}
+
+// countMismatches walks the raw message to find header counts that don't match the sections present.
+func countMismatches(raw []byte) []string {
+	layout, err := wire.Walk(raw)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return layout.Mismatches()
+}
+
+// pointerAnomalies walks the raw message to find loops, forward pointers and other malicious compression pointers.
+func pointerAnomalies(raw []byte) []string {
+	layout, err := wire.Walk(raw)
+	if err != nil {
+		return nil
+	}
+	return layout.PointerAnomalies(raw)
+}
@@ -65,9 +65,8 @@ func DetermineResolver(config models.Resolver) (models.Resolver, error) {
 
 	fmt.Printf("Using default DNS Resolver: %s:%d\n", primaryServer, port)
 
-	return models.Resolver{
-		UseSystemDefaults: true,
-		IP:                primaryServer,
-		Port:              port,
-	}, nil
+	// Anything but the address (e.g. the transport) is kept from the config
+	config.IP = primaryServer
+	config.Port = port
+	return config, nil
 }
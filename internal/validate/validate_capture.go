@@ -0,0 +1,35 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/capture"
+	"github.com/faanross/spinnekop/internal/models"
+)
+
+// validateCapture checks the capture block. The addresses are checked along with their
+// defaults, since the server takes the resolver's IP unless it's given.
+func validateCapture(cfg *models.Capture, qr bool, resolver models.Resolver) []error {
+	var errs []error
+
+	if cfg.Format != "" && cfg.Format != "pcap" && cfg.Format != "pcapng" {
+		errs = append(errs, fmt.Errorf("capture.format: must be pcap or pcapng, but got %s", cfg.Format))
+	}
+
+	if _, _, err := capture.Endpoints(*cfg, resolver); err != nil {
+		errs = append(errs, fmt.Errorf("capture.%w", err))
+	}
+
+	if _, err := capture.Start(*cfg); err != nil {
+		errs = append(errs, fmt.Errorf("capture.%w", err))
+	}
+
+	if cfg.ResponseDelay < 0 {
+		errs = append(errs, fmt.Errorf("capture.response_delay: must not be negative, but got %d", cfg.ResponseDelay))
+	}
+
+	if cfg.IncludeQuery && !qr {
+		errs = append(errs, fmt.Errorf("capture.include_query: only applies to responses (qr: true)"))
+	}
+
+	return errs
+}
@@ -0,0 +1,65 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+)
+
+// validateCompression checks the compression block. Pointers are meant to be
+// malicious, so we only check they can be resolved, the rest is left to the crafter
+// which knows the layout of the packed message. hasLabels is true if any name is
+// given as labels.
+func validateCompression(compression *models.Compression, hasLabels bool) []error {
+	var errs []error
+
+	switch compression.Mode {
+	case "", "off":
+	case "on":
+		// miekg's own pointers would point into names we modify,
+		// or past them, once labels change the size of the message
+		if len(compression.Pointers) > 0 {
+			errs = append(errs, fmt.Errorf("compression.pointers: can only be used with mode off"))
+		}
+		if hasLabels {
+			errs = append(errs, fmt.Errorf("compression.mode: names given as labels can only be used with mode off"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("compression.mode: must be on or off, but got %s", compression.Mode))
+	}
+
+	for i, pointer := range compression.Pointers {
+		field := fmt.Sprintf("compression.pointers[%d]", i)
+
+		if !wire.ValidRef(pointer.Name) {
+			errs = append(errs, fmt.Errorf("%s.name: invalid name reference %q, expected e.g. question[0] or answer[1]", field, pointer.Name))
+		}
+
+		if pointer.KeepLabels < 0 {
+			errs = append(errs, fmt.Errorf("%s.keep_labels: must not be negative, but got %d", field, pointer.KeepLabels))
+		}
+
+		switch pointer.Kind {
+		case "name", "forward", "mid_label":
+			if !wire.ValidRef(pointer.Target) {
+				errs = append(errs, fmt.Errorf("%s.target: invalid name reference %q, expected e.g. question[0] or answer[1]", field, pointer.Target))
+			}
+			if pointer.Kind == "mid_label" && pointer.Offset == 0 {
+				errs = append(errs, fmt.Errorf("%s.offset: must be at least 1 for kind mid_label, 0 is the start of the label", field))
+			}
+		case "header":
+			if pointer.Offset >= wire.HeaderLength {
+				errs = append(errs, fmt.Errorf("%s.offset: must be between 0 and %d for kind header, but got %d", field, wire.HeaderLength-1, pointer.Offset))
+			}
+		case "offset":
+			if pointer.Offset > 0x3FFF {
+				errs = append(errs, fmt.Errorf("%s.offset: must be between 0 and 16383 to fit in a pointer, but got %d", field, pointer.Offset))
+			}
+		case "loop":
+		default:
+			errs = append(errs, fmt.Errorf("%s.kind: must be one of name, loop, forward, header, mid_label or offset, but got %s", field, pointer.Kind))
+		}
+	}
+
+	return errs
+}
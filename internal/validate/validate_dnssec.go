@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+)
+
+// validateDNSSEC checks the dnssec block. The key file is only read when the message
+// is built, since that might happen on another machine (e.g. the agent's).
+// qr and hasLabels are the request's QR flag and whether any name is given as labels.
+func validateDNSSEC(dnssec *models.DNSSEC, qr bool, hasLabels bool) []error {
+	var errs []error
+
+	if !qr {
+		errs = append(errs, fmt.Errorf("dnssec: only applies to responses (qr: true)"))
+	}
+
+	// The records are signed before the labels are written, so the signatures would cover the wrong names
+	if hasLabels {
+		errs = append(errs, fmt.Errorf("dnssec: can't be used with names given as labels"))
+	}
+
+	if dnssec.Zone == "" {
+		errs = append(errs, fmt.Errorf("dnssec.zone: is required"))
+	} else if _, ok := dns.IsDomainName(dnssec.Zone); !ok {
+		errs = append(errs, fmt.Errorf("dnssec.zone: invalid name %s", dnssec.Zone))
+	}
+
+	if dnssec.Algorithm != "" {
+		if dnssec.KeyFile != "" {
+			errs = append(errs, fmt.Errorf("dnssec.algorithm: only applies to ephemeral keys, the key file has its own"))
+		}
+		if _, ok := models.DNSSECAlgorithmMap[dnssec.Algorithm]; !ok {
+			errs = append(errs, fmt.Errorf("dnssec.algorithm: must be one of RSASHA256, RSASHA512, ECDSAP256SHA256, ECDSAP384SHA384 or ED25519, but got %s", dnssec.Algorithm))
+		}
+	}
+
+	switch dnssec.Signatures {
+	case "", "valid", "expired", "not_yet_valid", "mismatched":
+	default:
+		errs = append(errs, fmt.Errorf("dnssec.signatures: must be one of valid, expired, not_yet_valid or mismatched, but got %s", dnssec.Signatures))
+	}
+
+	switch dnssec.Denial {
+	case "", "nsec", "nsec3":
+	default:
+		errs = append(errs, fmt.Errorf("dnssec.denial: must be nsec or nsec3, but got %s", dnssec.Denial))
+	}
+
+	if dnssec.NextName != "" {
+		if dnssec.Denial == "" {
+			errs = append(errs, fmt.Errorf("dnssec.next_name: only applies with denial"))
+		}
+		if _, ok := dns.IsDomainName(dnssec.NextName); !ok {
+			errs = append(errs, fmt.Errorf("dnssec.next_name: invalid name %s", dnssec.NextName))
+		}
+	}
+
+	if dnssec.Denial != "nsec3" && (dnssec.NSEC3Iterations != 0 || dnssec.NSEC3Salt != "") {
+		errs = append(errs, fmt.Errorf("dnssec.nsec3_iterations and nsec3_salt: only apply to denial nsec3"))
+	}
+	if salt, err := hex.DecodeString(dnssec.NSEC3Salt); err != nil {
+		errs = append(errs, fmt.Errorf("dnssec.nsec3_salt: must be hex, %v", err))
+	} else if len(salt) > 255 {
+		errs = append(errs, fmt.Errorf("dnssec.nsec3_salt: must be at most 255 bytes, but got %d", len(salt)))
+	}
+
+	return errs
+}
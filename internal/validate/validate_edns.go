@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"net"
+)
+
+// validateEDNS checks the edns block. Non-standard values (unknown versions,
+// reserved flag bits, duplicate options) are allowed on purpose, we only
+// reject what cannot be represented on the wire.
+func validateEDNS(edns *models.EDNS) []error {
+	var errs []error
+
+	// make sure EDNS.Z is not >0x7FFF, the top bit of the 16-bit field is DO
+	if edns.Z > 0x7FFF {
+		errs = append(errs, fmt.Errorf("edns.z: must be between 0 and 32767, but got %d", edns.Z))
+	}
+
+	for i, option := range edns.Options {
+		field := fmt.Sprintf("edns.options[%d]", i)
+
+		code, ok := models.EDNSOptionMap[option.Type]
+		if !ok && option.Type != "CUSTOM" {
+			errs = append(errs, fmt.Errorf("%s.type: invalid option type: %s", field, option.Type))
+			continue
+		}
+
+		// CUSTOM options always use their raw payload
+		if option.Type == "CUSTOM" {
+			code = 0
+		}
+
+		switch code {
+		case dns.EDNS0SUBNET:
+			ip := net.ParseIP(option.Address)
+			if ip == nil {
+				errs = append(errs, fmt.Errorf("%s.address: not a valid IP address: %s", field, option.Address))
+				break
+			}
+
+			// family is derived from the address if it's not set
+			family := option.Family
+			if family == 0 {
+				family = 2
+				if ip.To4() != nil {
+					family = 1
+				}
+			}
+
+			var maxNetmask uint8
+			switch family {
+			case 1:
+				maxNetmask = 32
+				if ip.To4() == nil {
+					errs = append(errs, fmt.Errorf("%s.address: family 1 requires an IPv4 address, but got %s", field, option.Address))
+				}
+			case 2:
+				maxNetmask = 128
+			default:
+				errs = append(errs, fmt.Errorf("%s.family: must be 1 (IPv4) or 2 (IPv6), use a CUSTOM option for anything else", field))
+				continue
+			}
+
+			if option.SourceNetmask > maxNetmask {
+				errs = append(errs, fmt.Errorf("%s.source_netmask: must be at most %d for family %d, but got %d", field, maxNetmask, family, option.SourceNetmask))
+			}
+
+		case dns.EDNS0COOKIE:
+			if _, err := hex.DecodeString(option.Cookie); err != nil {
+				errs = append(errs, fmt.Errorf("%s.cookie: not a valid hex string: %v", field, err))
+			}
+
+		case dns.EDNS0PADDING:
+			// any length works
+
+		default:
+			if _, err := hex.DecodeString(option.Data); err != nil {
+				errs = append(errs, fmt.Errorf("%s.data: not a valid hex string: %v", field, err))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,95 @@
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+)
+
+// validateLabels checks a name given as labels. Anything RFC 1035 forbids is only
+// accepted with allow_violations, except for labels over 255 bytes, which can't be
+// written at all. The field argument is the name's prefix, e.g. "answers[0]".
+func validateLabels(field string, name string, labels []models.Label, allowViolations bool) []error {
+	var errs []error
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	if name != "" {
+		errs = append(errs, fmt.Errorf("%s: name and labels cannot both be set", field))
+	}
+
+	// The name's length on the wire includes the length bytes and the root label
+	nameLength := 1
+	var violations []string
+
+	for i, label := range labels {
+		labelField := fmt.Sprintf("%s.labels[%d]", field, i)
+
+		if label.Text != "" && label.Hex != "" {
+			errs = append(errs, fmt.Errorf("%s: text and hex cannot both be set", labelField))
+			continue
+		}
+
+		data := []byte(label.Text)
+		if label.Hex != "" {
+			var err error
+			data, err = hex.DecodeString(label.Hex)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s.hex: not a valid hex string: %v", labelField, err))
+				continue
+			}
+		}
+
+		if len(data) > 255 {
+			errs = append(errs, fmt.Errorf("%s: label is %d bytes, but its length has to fit in a single byte (max 255)", labelField, len(data)))
+			continue
+		}
+
+		nameLength += 1 + len(data)
+
+		// An empty label is the root, so anything after it is no longer part of the name
+		if len(data) == 0 {
+			violations = append(violations, fmt.Sprintf("%s: empty label ends the name early", labelField))
+		}
+		if len(data) > 63 {
+			violations = append(violations, fmt.Sprintf("%s: label is %d bytes (max 63)", labelField, len(data)))
+		}
+		for _, b := range data {
+			if b == '.' || b < 0x21 || b > 0x7E {
+				violations = append(violations, fmt.Sprintf("%s: label contains dots, spaces or binary bytes", labelField))
+				break
+			}
+		}
+	}
+
+	if nameLength > 255 {
+		violations = append(violations, fmt.Sprintf("%s: name is %d bytes on the wire (max 255)", field, nameLength))
+	}
+
+	if !allowViolations {
+		for _, violation := range violations {
+			errs = append(errs, fmt.Errorf("%s (set allow_violations to permit this)", violation))
+		}
+	}
+
+	return errs
+}
+
+// hasLabels reports whether any question or record name is given as labels.
+func hasLabels(dnsRequest *models.DNSRequest) bool {
+	for _, question := range dnsRequest.AllQuestions() {
+		if len(question.Labels) > 0 {
+			return true
+		}
+	}
+	for _, section := range [][]models.Answer{dnsRequest.Answers, dnsRequest.Authority, dnsRequest.Additional} {
+		for _, record := range section {
+			if len(record.Labels) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+)
+
+// validatePatches checks the patches list. Whether an anchor or offset lies
+// within the message can only be known once it's packed, so that's left to the crafter.
+func validatePatches(patches []models.Patch) []error {
+	var errs []error
+
+	for i, patch := range patches {
+		field := fmt.Sprintf("patches[%d]", i)
+
+		// A patch does exactly one thing
+		actions := 0
+		if patch.Bytes != "" {
+			actions++
+		}
+		if patch.Mask != "" || patch.Value != "" {
+			actions++
+		}
+		if patch.Append != "" {
+			actions++
+		}
+		if actions != 1 {
+			errs = append(errs, fmt.Errorf("%s: must set exactly one of bytes, mask and value, or append", field))
+			continue
+		}
+
+		if patch.Append != "" {
+			if patch.Anchor != "" || patch.Offset != nil {
+				errs = append(errs, fmt.Errorf("%s: append always adds to the end, so it can't have an anchor or offset", field))
+			}
+			if _, err := hex.DecodeString(patch.Append); err != nil {
+				errs = append(errs, fmt.Errorf("%s.append: not a valid hex string: %v", field, err))
+			}
+			continue
+		}
+
+		if patch.Anchor == "" && patch.Offset == nil {
+			errs = append(errs, fmt.Errorf("%s: needs an anchor or an offset", field))
+		}
+		if patch.Anchor != "" && !wire.ValidAnchor(patch.Anchor) {
+			errs = append(errs, fmt.Errorf("%s.anchor: invalid anchor %q, expected e.g. header.flags, question.qtype or answer[0].rdlength", field, patch.Anchor))
+		}
+
+		if patch.Bytes != "" {
+			if _, err := hex.DecodeString(patch.Bytes); err != nil {
+				errs = append(errs, fmt.Errorf("%s.bytes: not a valid hex string: %v", field, err))
+			}
+			continue
+		}
+
+		mask, err := hex.DecodeString(patch.Mask)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.mask: not a valid hex string: %v", field, err))
+		}
+		value, err := hex.DecodeString(patch.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.value: not a valid hex string: %v", field, err))
+		}
+		if len(mask) == 0 || len(mask) != len(value) {
+			errs = append(errs, fmt.Errorf("%s: mask and value must both be set and of the same length", field))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,20 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+)
+
+// validatePlaceholders checks the syntax of the placeholders in every field they're expanded in.
+func validatePlaceholders(req *models.DNSRequest) []error {
+	var errs []error
+
+	for _, field := range crafter.PlaceholderFields(req) {
+		if err := crafter.CheckPlaceholders(*field.Value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", field.Name, err))
+		}
+	}
+
+	return errs
+}
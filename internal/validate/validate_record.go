@@ -0,0 +1,178 @@
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+	"net"
+)
+
+// validateRecord checks a single resource record. The field argument is used as a prefix
+// for all errors (e.g. "answers[2]") so it's clear which record and field is at fault.
+func validateRecord(field string, record models.Answer) []error {
+	var errs []error
+
+	// Raw records are checked separately, since their type doesn't have to be known
+	if record.TypeCode != 0 || record.RawRData != "" {
+		return validateRawRecord(field, record)
+	}
+
+	// make sure the record type appears in our QTypeMap
+	rrType, ok := models.QTypeMap[record.Type]
+	if !ok {
+		if record.Type == "" {
+			// an unquoted NULL is parsed as an empty value by YAML
+			return append(errs, fmt.Errorf("%s.type: record type is empty (note: NULL has to be quoted in YAML)", field))
+		}
+		return append(errs, fmt.Errorf("%s.type: invalid record type: %s", field, record.Type))
+	}
+
+	errs = append(errs, validateRecordClass(field, record)...)
+
+	if record.Name != "" {
+		if _, ok := dns.IsDomainName(record.Name); !ok {
+			errs = append(errs, fmt.Errorf("%s.name: not a valid domain name: %s", field, record.Name))
+		}
+	}
+
+	// Structured RDATA takes precedence over data
+	if record.RData != nil {
+		if record.TXT != nil {
+			errs = append(errs, fmt.Errorf("%s.txt: only applies to TXT records given as data", field))
+		}
+		return append(errs, validateStructuredRData(field+".rdata", rrType, record)...)
+	}
+
+	// TXT data is used as-is, but the way it's split up has to work out
+	if rrType == dns.TypeTXT {
+		if _, err := crafter.SplitTXT(record); err != nil {
+			errs = append(errs, fmt.Errorf("%s.txt: %v", field, err))
+		}
+		return errs
+	}
+
+	// anything else has to be valid presentation format
+	if record.TXT != nil {
+		errs = append(errs, fmt.Errorf("%s.txt: only applies to TXT records", field))
+	}
+
+	if record.Data == "" {
+		return append(errs, fmt.Errorf("%s.data: RDATA is required for type %s", field, record.Type))
+	}
+
+	line := fmt.Sprintf(". 0 IN %s %s", record.Type, record.Data)
+	if _, err := dns.NewRR(line); err != nil {
+		errs = append(errs, fmt.Errorf("%s.data: invalid RDATA for type %s: %v", field, record.Type, err))
+	}
+
+	return errs
+}
+
+// validateRecordClass checks the class of a record, like validateQuestion does for questions.
+func validateRecordClass(field string, record models.Answer) []error {
+	// Validate Answer.Class based on StdClass flag, custom classes can be any value
+	if record.UsesStdClass() {
+		// Standard class mode - check if it's in our map (or the generic CLASSnnn form)
+		if _, err := crafter.ParseGenericClass(record.Class); err != nil {
+			return []error{fmt.Errorf("%s.class: invalid standard record class: %s", field, record.Class)}
+		}
+	}
+	return nil
+}
+
+// validateRawRecord checks a record whose RDATA is given in RFC 3597 generic encoding.
+func validateRawRecord(field string, record models.Answer) []error {
+	var errs []error
+
+	// type_code replaces type, so type only has to be valid if type_code isn't set
+	if record.TypeCode == 0 {
+		if _, ok := models.QTypeMap[record.Type]; !ok {
+			errs = append(errs, fmt.Errorf("%s.type: invalid record type: %s", field, record.Type))
+		}
+	}
+
+	errs = append(errs, validateRecordClass(field, record)...)
+
+	if record.Name != "" {
+		if _, ok := dns.IsDomainName(record.Name); !ok {
+			errs = append(errs, fmt.Errorf("%s.name: not a valid domain name: %s", field, record.Name))
+		}
+	}
+
+	if record.TXT != nil {
+		errs = append(errs, fmt.Errorf("%s.txt: only applies to TXT records given as data", field))
+	}
+
+	if record.RawRData == "" {
+		return append(errs, fmt.Errorf("%s.raw_rdata: is required when type_code is set", field))
+	}
+
+	if _, err := crafter.ParseRawRData(record.RawRData); err != nil {
+		errs = append(errs, fmt.Errorf("%s.raw_rdata: %v", field, err))
+	}
+
+	return errs
+}
+
+// validateStructuredRData checks the fields of the rdata block that belong to the record type.
+func validateStructuredRData(field string, rrType uint16, record models.Answer) []error {
+	var errs []error
+	rdata := record.RData
+
+	// checkName makes sure a domain name field is both present and valid
+	checkName := func(name, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s.%s: is required for type %s", field, name, record.Type))
+			return
+		}
+		if _, ok := dns.IsDomainName(value); !ok {
+			errs = append(errs, fmt.Errorf("%s.%s: not a valid domain name: %s", field, name, value))
+		}
+	}
+
+	switch rrType {
+	case dns.TypeA:
+		if ip := net.ParseIP(rdata.Address); ip == nil || ip.To4() == nil {
+			errs = append(errs, fmt.Errorf("%s.address: not a valid IPv4 address: %s", field, rdata.Address))
+		}
+
+	case dns.TypeAAAA:
+		if ip := net.ParseIP(rdata.Address); ip == nil || ip.To4() != nil {
+			errs = append(errs, fmt.Errorf("%s.address: not a valid IPv6 address: %s", field, rdata.Address))
+		}
+
+	case dns.TypeCNAME, dns.TypeNS, dns.TypePTR, dns.TypeMX, dns.TypeSRV:
+		checkName("target", rdata.Target)
+
+	case dns.TypeSOA:
+		checkName("mname", rdata.MName)
+		checkName("rname", rdata.RName)
+
+	case dns.TypeCAA:
+		if rdata.Tag == "" {
+			errs = append(errs, fmt.Errorf("%s.tag: is required for type CAA", field))
+		}
+
+	case dns.TypeNULL:
+		data, err := hex.DecodeString(rdata.Hex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.hex: not a valid hex string: %v", field, err))
+		} else if len(data) > 65535 {
+			errs = append(errs, fmt.Errorf("%s.hex: RDATA can be at most 65535 bytes, but got %d", field, len(data)))
+		}
+
+	case dns.TypeHTTPS:
+		checkName("target", rdata.Target)
+		line := fmt.Sprintf(". 0 IN HTTPS %d %s %s", rdata.Priority, dns.Fqdn(rdata.Target), rdata.Params)
+		if _, err := dns.NewRR(line); err != nil {
+			errs = append(errs, fmt.Errorf("%s.params: invalid SvcParams: %v", field, err))
+		}
+
+	default:
+		errs = append(errs, fmt.Errorf("%s: structured rdata is not supported for type %s, use data instead", field, record.Type))
+	}
+
+	return errs
+}
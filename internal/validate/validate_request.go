@@ -2,7 +2,10 @@ package validate
 
 import (
 	"fmt"
+	"github.com/faanross/spinnekop/internal/crafter"
 	"github.com/faanross/spinnekop/internal/models"
+	"github.com/faanross/spinnekop/internal/wire"
+	"github.com/miekg/dns"
 	"net"
 	"strings"
 )
@@ -26,16 +29,56 @@ func ValidateRequest(dnsRequest *models.DNSRequest) error {
 
 	var validateErrs ValidationErrors
 
+	// PLACEHOLDER VALIDATION
+	// The agent expands placeholders when it sends the message, so we check their syntax
+	// here and validate everything else the way it will look once they're expanded
+	placeholderErrs := validatePlaceholders(dnsRequest)
+	validateErrs = append(validateErrs, placeholderErrs...)
+	if len(placeholderErrs) == 0 {
+		expanded, err := crafter.NewExpander().Expand(*dnsRequest)
+		if err != nil {
+			validateErrs = append(validateErrs, err)
+		} else {
+			dnsRequest = &expanded
+		}
+	}
+
 	// HEADER SECTION VALIDATION
 
-	// make sure Header.OpCode appears in our OpCodeMap
-	if _, ok := models.OpCodeMap[dnsRequest.Header.OpCode]; !ok {
-		validateErrs = append(validateErrs, fmt.Errorf("invalid opcode: %s", dnsRequest.Header.OpCode))
+	// Validate Header.OpCode based on StdOpCode flag
+	if dnsRequest.Header.UsesStdOpCode() {
+		// Standard opcode mode - make sure Header.OpCode appears in our OpCodeMap
+		if _, ok := models.OpCodeMap[dnsRequest.Header.OpCode]; !ok {
+			validateErrs = append(validateErrs, fmt.Errorf("invalid opcode: %s", dnsRequest.Header.OpCode))
+		}
+	} else if dnsRequest.Header.CustomOpCode > 15 {
+		// Custom opcode mode - it's a 4-bit field, so make sure it's not >15
+		validateErrs = append(validateErrs, fmt.Errorf("custom opcode must be between 0 and 15, but got %d", dnsRequest.Header.CustomOpCode))
 	}
 
-	// make sure Header.Z is not >7 (note uint8 already ensure it's >=0)
-	if dnsRequest.Header.Z > 7 {
-		validateErrs = append(validateErrs, fmt.Errorf("Z flag must be between 0 and 7, but got %d", dnsRequest.Header.Z))
+	// make sure Header.Z is not >1 (note uint8 already ensure it's >=0)
+	// The other 2 bits that used to be part of Z have their own flags now,
+	// the loaders map the old 3-bit values onto them (see Header.MigrateLegacyZ)
+	if dnsRequest.Header.Z > 1 {
+		validateErrs = append(validateErrs, fmt.Errorf("Z flag must be 0 or 1, but got %d: z used to hold 3 bits, "+
+			"the lower 2 of which moved to authenticated_data (AD) and checking_disabled (CD)", dnsRequest.Header.Z))
+	}
+
+	// ID STRATEGY VALIDATION
+	if strategy := dnsRequest.Header.IDStrategy; strategy != nil {
+		switch strategy.Mode {
+		case "random", "increment", "constant":
+		case "list":
+			if len(strategy.List) == 0 {
+				validateErrs = append(validateErrs, fmt.Errorf("id_strategy.list: needs at least one ID for mode list"))
+			}
+		default:
+			validateErrs = append(validateErrs, fmt.Errorf("id_strategy.mode: must be one of random, increment, list or constant, but got %s", strategy.Mode))
+		}
+
+		if strategy.Seed != nil && strategy.Mode != "random" {
+			validateErrs = append(validateErrs, fmt.Errorf("id_strategy.seed: only applies to mode random"))
+		}
 	}
 
 	// make sure Header.RCode is not >15 (note uint8 already ensure it's >=0)
@@ -44,18 +87,115 @@ func ValidateRequest(dnsRequest *models.DNSRequest) error {
 	}
 
 	// QUESTION SECTION VALIDATION
-	// make sure Question.Type appears in our QTypeMap
-	if _, ok := models.QTypeMap[dnsRequest.Question.Type]; !ok {
-		validateErrs = append(validateErrs, fmt.Errorf("invalid question type: %s", dnsRequest.Question.Type))
+	// question and questions are mutually exclusive, otherwise it's unclear which one is used
+	if len(dnsRequest.Questions) > 0 && (dnsRequest.Question.Name != "" || dnsRequest.Question.Type != "") {
+		validateErrs = append(validateErrs, fmt.Errorf("question and questions cannot both be set, use questions for more than one question"))
 	}
 
-	// Validate Question.Class based on StdClass flag
-	if dnsRequest.Question.StdClass {
-		// Standard class mode - check if it's in our map
-		if _, ok := models.QClassMap[dnsRequest.Question.Class]; !ok {
-			validateErrs = append(validateErrs, fmt.Errorf("invalid standard question class: %s", dnsRequest.Question.Class))
+	// Names given as labels may break the RFC limits, but only if explicitly allowed
+	allowViolations := dnsRequest.AllowViolations
+
+	if len(dnsRequest.Questions) > 0 {
+		for i, question := range dnsRequest.Questions {
+			field := fmt.Sprintf("questions[%d]", i)
+			validateErrs = append(validateErrs, validateQuestion(field, question)...)
+			validateErrs = append(validateErrs, validateLabels(field, question.Name, question.Labels, allowViolations)...)
+		}
+	} else {
+		validateErrs = append(validateErrs, validateQuestion("question", dnsRequest.Question)...)
+		validateErrs = append(validateErrs, validateLabels("question", dnsRequest.Question.Name, dnsRequest.Question.Labels, allowViolations)...)
+	}
+
+	// ANSWER, AUTHORITY AND ADDITIONAL SECTION VALIDATION
+	sections := []struct {
+		name    string
+		records []models.Answer
+	}{
+		{"answers", dnsRequest.Answers},
+		{"authority", dnsRequest.Authority},
+		{"additional", dnsRequest.Additional},
+	}
+	for _, section := range sections {
+		for i, record := range section.records {
+			field := fmt.Sprintf("%s[%d]", section.name, i)
+			validateErrs = append(validateErrs, validateRecord(field, record)...)
+			validateErrs = append(validateErrs, validateLabels(field, record.Name, record.Labels, allowViolations)...)
+		}
+	}
+
+	// UPDATE VALIDATION
+	// The zone, prerequisites and operations take the place of the question, answers and authority
+	if update := dnsRequest.Update; update != nil {
+		if len(dnsRequest.Questions) > 0 || dnsRequest.Question.Name != "" || dnsRequest.Question.Type != "" {
+			validateErrs = append(validateErrs, fmt.Errorf("update: question and questions cannot be set, update.zone is the zone section"))
+		}
+		if len(dnsRequest.Answers) > 0 || len(dnsRequest.Authority) > 0 {
+			validateErrs = append(validateErrs, fmt.Errorf("update: answers and authority cannot be set, they hold the prerequisites and operations"))
+		}
+		validateErrs = append(validateErrs, validateUpdate(update)...)
+	}
+
+	// TRANSFER VALIDATION
+	// The agent only transfers a zone if the first question asks for one
+	if transfer := dnsRequest.Transfer; transfer != nil {
+		question := dnsRequest.AllQuestions()[0]
+		qType := question.CustomType
+		if question.UsesStdType() {
+			qType = models.QTypeMap[question.Type]
+		}
+		if qType != dns.TypeAXFR && qType != dns.TypeIXFR {
+			validateErrs = append(validateErrs, fmt.Errorf("transfer: only applies when the (first) question is of type AXFR or IXFR"))
+		}
+		if transfer.Timeout < 0 {
+			validateErrs = append(validateErrs, fmt.Errorf("transfer.timeout: must not be negative, but got %d", transfer.Timeout))
+		}
+	}
+
+	// CAPTURE VALIDATION
+	if dnsRequest.Capture != nil {
+		validateErrs = append(validateErrs, validateCapture(dnsRequest.Capture, dnsRequest.Header.QR, dnsRequest.Resolver)...)
+	}
+
+	// EDNS VALIDATION
+	if dnsRequest.EDNS != nil {
+		validateErrs = append(validateErrs, validateEDNS(dnsRequest.EDNS)...)
+	}
+
+	// COMPRESSION VALIDATION
+	if dnsRequest.Compression != nil {
+		validateErrs = append(validateErrs, validateCompression(dnsRequest.Compression, hasLabels(dnsRequest))...)
+	}
+
+	// DNSSEC VALIDATION
+	if dnssec := dnsRequest.DNSSEC; dnssec != nil {
+		validateErrs = append(validateErrs, validateDNSSEC(dnssec, dnsRequest.Header.QR, hasLabels(dnsRequest))...)
+	}
+
+	// TSIG VALIDATION
+	if dnsRequest.TSIG != nil {
+		validateErrs = append(validateErrs, validateTSIG(dnsRequest.TSIG)...)
+	}
+
+	// SIZE POLICY VALIDATION
+	// Truncating is what servers do to responses, a query has nothing to drop
+	if size := dnsRequest.Size; size != nil {
+		switch size.Policy {
+		case "strict":
+			if !dnsRequest.Header.QR {
+				validateErrs = append(validateErrs, fmt.Errorf("size.policy: strict only applies to responses (qr: true)"))
+			}
+		case "warn", "oversize":
+		default:
+			validateErrs = append(validateErrs, fmt.Errorf("size.policy: must be one of strict, warn or oversize, but got %s", size.Policy))
+		}
+		if size.Limit != 0 && (size.Limit < wire.HeaderLength || size.Limit > 65535) {
+			validateErrs = append(validateErrs, fmt.Errorf("size.limit: must be between %d and 65535, but got %d", wire.HeaderLength, size.Limit))
 		}
 	}
+
+	// PATCHES VALIDATION
+	validateErrs = append(validateErrs, validatePatches(dnsRequest.Patches)...)
+
 	// RESOLVER SECTION VALIDATION
 
 	// if UseSystemDefaults when false
@@ -71,9 +211,45 @@ func ValidateRequest(dnsRequest *models.DNSRequest) error {
 		}
 	}
 
+	// Resolver.Transport has to be one we can send over, and only tcp has knobs
+	switch dnsRequest.Resolver.Transport {
+	case "", "udp", "tcp":
+	default:
+		validateErrs = append(validateErrs, fmt.Errorf("resolver transport must be udp or tcp, but got %s", dnsRequest.Resolver.Transport))
+	}
+	if tcp := dnsRequest.Resolver.TCP; tcp != nil {
+		if dnsRequest.Resolver.Transport != "tcp" {
+			validateErrs = append(validateErrs, fmt.Errorf("resolver tcp: only applies to transport tcp"))
+		}
+		validateErrs = append(validateErrs, validateTCPOptions(tcp)...)
+	}
+
 	if len(validateErrs) > 0 {
 		return validateErrs
 	}
 
 	return nil
 }
+
+// validateQuestion checks a single question, field is used as a prefix for all errors.
+func validateQuestion(field string, question models.Question) []error {
+	var errs []error
+
+	// Validate Question.Type based on StdType flag
+	if question.UsesStdType() {
+		// Standard type mode - make sure Question.Type appears in our QTypeMap
+		if _, ok := models.QTypeMap[question.Type]; !ok {
+			errs = append(errs, fmt.Errorf("%s.type: invalid question type: %s", field, question.Type))
+		}
+	}
+
+	// Validate Question.Class based on StdClass flag
+	if question.UsesStdClass() {
+		// Standard class mode - check if it's in our map
+		if _, ok := models.QClassMap[question.Class]; !ok {
+			errs = append(errs, fmt.Errorf("%s.class: invalid standard question class: %s", field, question.Class))
+		}
+	}
+
+	return errs
+}
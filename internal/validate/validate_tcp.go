@@ -0,0 +1,34 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+)
+
+// validateTCPOptions checks the knobs of the tcp transport. A length prefix that doesn't
+// match the message is the point, so any value that fits in the prefix is allowed.
+func validateTCPOptions(tcp *models.TCPOptions) []error {
+	var errs []error
+
+	if tcp.LengthPrefix != nil && tcp.LengthDelta != 0 {
+		errs = append(errs, fmt.Errorf("resolver tcp.length_prefix and tcp.length_delta: only one can be set"))
+	}
+	if tcp.LengthDelta < -0xFFFF || tcp.LengthDelta > 0xFFFF {
+		errs = append(errs, fmt.Errorf("resolver tcp.length_delta: must be between -65535 and 65535, but got %d", tcp.LengthDelta))
+	}
+
+	for i, size := range tcp.Segments {
+		if size < 1 {
+			errs = append(errs, fmt.Errorf("resolver tcp.segments[%d]: must be at least 1 byte, but got %d", i, size))
+		}
+	}
+	if tcp.SegmentDelay < 0 {
+		errs = append(errs, fmt.Errorf("resolver tcp.segment_delay: must not be negative, but got %d", tcp.SegmentDelay))
+	}
+
+	if tcp.Pipeline < 0 {
+		errs = append(errs, fmt.Errorf("resolver tcp.pipeline: must not be negative, but got %d", tcp.Pipeline))
+	}
+
+	return errs
+}
@@ -0,0 +1,50 @@
+package validate
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+)
+
+// validateTSIG checks the tsig block. The knobs that break the signature on
+// purpose (bad_mac, time_skew and wrong_key_name) are all allowed.
+func validateTSIG(tsig *models.TSIG) []error {
+	var errs []error
+
+	if tsig.KeyName == "" {
+		errs = append(errs, fmt.Errorf("tsig.key_name: is required"))
+	} else if _, ok := dns.IsDomainName(tsig.KeyName); !ok {
+		errs = append(errs, fmt.Errorf("tsig.key_name: invalid name %s", tsig.KeyName))
+	}
+
+	if tsig.WrongKeyName != "" {
+		if _, ok := dns.IsDomainName(tsig.WrongKeyName); !ok {
+			errs = append(errs, fmt.Errorf("tsig.wrong_key_name: invalid name %s", tsig.WrongKeyName))
+		}
+	}
+
+	if _, ok := models.TSIGAlgorithmMap[tsig.Algorithm]; !ok {
+		errs = append(errs, fmt.Errorf("tsig.algorithm: must be one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512, but got %s", tsig.Algorithm))
+	}
+
+	if secret, err := base64.StdEncoding.DecodeString(tsig.Secret); err != nil {
+		errs = append(errs, fmt.Errorf("tsig.secret: must be base64, %v", err))
+	} else if len(secret) == 0 {
+		errs = append(errs, fmt.Errorf("tsig.secret: is required"))
+	}
+
+	if _, err := hex.DecodeString(tsig.RequestMAC); err != nil {
+		errs = append(errs, fmt.Errorf("tsig.request_mac: must be hex, %v", err))
+	}
+
+	// Without a time signed, the skew is relative to the current time, which is checked when signing
+	if tsig.TimeSigned > 0 {
+		if t := int64(tsig.TimeSigned) + tsig.TimeSkew; tsig.TimeSigned > 1<<48-1 || t < 0 || t > 1<<48-1 {
+			errs = append(errs, fmt.Errorf("tsig.time_signed: %d (after a skew of %d) does not fit in 48 bits", tsig.TimeSigned, tsig.TimeSkew))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/faanross/spinnekop/internal/models"
+	"github.com/miekg/dns"
+)
+
+// validateUpdate checks the update block. The records of prerequisites and operations
+// that carry RDATA are checked like any other record.
+func validateUpdate(update *models.Update) []error {
+	var errs []error
+
+	if update.Zone == "" {
+		errs = append(errs, fmt.Errorf("update.zone: is required"))
+	} else if _, ok := dns.IsDomainName(update.Zone); !ok {
+		errs = append(errs, fmt.Errorf("update.zone: invalid name %s", update.Zone))
+	}
+
+	if update.Class != "" {
+		if _, ok := models.QClassMap[update.Class]; !ok {
+			errs = append(errs, fmt.Errorf("update.class: invalid class: %s", update.Class))
+		}
+	}
+
+	for i, prerequisite := range update.Prerequisites {
+		field := fmt.Sprintf("update.prerequisites[%d]", i)
+
+		switch prerequisite.Condition {
+		case "rrset_exists_value":
+			errs = append(errs, validateUpdateRecord(field, prerequisite.Name, prerequisite.Type, prerequisite.Data, prerequisite.RData)...)
+		case "rrset_exists", "rrset_not_exists":
+			errs = append(errs, validateUpdateHeader(field, prerequisite.Name, prerequisite.Type, false)...)
+		case "name_in_use", "name_not_in_use":
+			errs = append(errs, validateUpdateHeader(field, prerequisite.Name, prerequisite.Type, true)...)
+		default:
+			errs = append(errs, fmt.Errorf("%s.condition: must be one of rrset_exists, rrset_exists_value, rrset_not_exists, name_in_use or name_not_in_use, but got %s", field, prerequisite.Condition))
+		}
+	}
+
+	for i, operation := range update.Operations {
+		field := fmt.Sprintf("update.operations[%d]", i)
+
+		switch operation.Action {
+		case "add", "delete":
+			errs = append(errs, validateUpdateRecord(field, operation.Name, operation.Type, operation.Data, operation.RData)...)
+			if operation.Action == "delete" && operation.TTL != 0 {
+				errs = append(errs, fmt.Errorf("%s.ttl: only applies to add, delete always uses 0", field))
+			}
+		case "delete_rrset":
+			errs = append(errs, validateUpdateHeader(field, operation.Name, operation.Type, false)...)
+		case "delete_name":
+			errs = append(errs, validateUpdateHeader(field, operation.Name, operation.Type, true)...)
+		default:
+			errs = append(errs, fmt.Errorf("%s.action: must be one of add, delete_rrset, delete_name or delete, but got %s", field, operation.Action))
+		}
+	}
+
+	return errs
+}
+
+// validateUpdateRecord checks a prerequisite or operation that carries RDATA.
+func validateUpdateRecord(field string, name string, rrType string, data string, rdata *models.RData) []error {
+	if name == "" {
+		return []error{fmt.Errorf("%s.name: is required", field)}
+	}
+	return validateRecord(field, models.Answer{
+		Name:     name,
+		Type:     rrType,
+		Class:    "IN",
+		StdClass: true,
+		Data:     data,
+		RData:    rdata,
+	})
+}
+
+// validateUpdateHeader checks a prerequisite or operation that only needs a name (and type).
+func validateUpdateHeader(field string, name string, rrType string, nameOnly bool) []error {
+	var errs []error
+
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		errs = append(errs, fmt.Errorf("%s.name: not a valid domain name: %s", field, name))
+	}
+
+	if nameOnly {
+		if rrType != "" {
+			errs = append(errs, fmt.Errorf("%s.type: doesn't apply, every type at the name is meant", field))
+		}
+	} else if _, ok := models.QTypeMap[rrType]; !ok {
+		errs = append(errs, fmt.Errorf("%s.type: invalid type: %s", field, rrType))
+	}
+
+	return errs
+}
@@ -2,7 +2,11 @@ package visualizer
 
 import (
 	"fmt"
+	"github.com/faanross/spinnekop/internal/analyzer"
+	"github.com/faanross/spinnekop/internal/crafter"
+	"github.com/faanross/spinnekop/internal/wire"
 	"github.com/fatih/color"
+	"github.com/miekg/dns"
 	"strings"
 )
 
@@ -13,6 +17,21 @@ const (
 
 // VisualizePacket prints a DNS packet in a user-friendly hex and ASCII format.
 func VisualizePacket(packet []byte) {
+	visualize(packet, nil)
+}
+
+// VisualizePatchedPacket prints a DNS packet like VisualizePacket, but highlights
+// the bytes at the given offsets, i.e. the ones changed by patches.
+func VisualizePatchedPacket(packet []byte, patched []int) {
+	highlight := make(map[int]bool)
+	for _, offset := range patched {
+		highlight[offset] = true
+	}
+	visualize(packet, highlight)
+}
+
+// visualize does the actual printing, bytes whose offset is in highlight are shown in red.
+func visualize(packet []byte, highlight map[int]bool) {
 
 	color.Cyan("---------------------->>> DNS PACKET VISUALIZATION <<<----------------------")
 
@@ -23,11 +42,17 @@ func VisualizePacket(packet []byte) {
 
 	// strings.Builder is built for efficiently building a string from multiple pieces.
 	var hexBuilder, asciiBuilder strings.Builder
+	highlightColor := color.New(color.FgRed, color.Bold)
 
 	for i, b := range packet {
 
 		// Build our HEX Output
-		hexBuilder.WriteString(fmt.Sprintf("%02X ", b))
+		// Highlighted bytes carry color codes, so we can't rely on %-48s for padding below
+		if highlight[i] {
+			hexBuilder.WriteString(highlightColor.Sprintf("%02X", b) + " ")
+		} else {
+			hexBuilder.WriteString(fmt.Sprintf("%02X ", b))
+		}
 
 		// Build our ASCII Output
 
@@ -45,8 +70,9 @@ func VisualizePacket(packet []byte) {
 			color.New(color.FgYellow).Printf("0x%04X | ", i-((i)%bytesPerRow))
 
 			// Print the hex part, padded to a fixed width for alignment.
-			hexStr := hexBuilder.String()
-			fmt.Printf("%-48s", hexStr) // 16 bytes * 3 chars/byte (XX ) = 48
+			// 16 bytes * 3 chars/byte (XX ) = 48
+			rowLength := i%bytesPerRow + 1
+			fmt.Print(hexBuilder.String() + strings.Repeat(" ", (bytesPerRow-rowLength)*3))
 
 			// Print the ASCII part.
 
@@ -60,4 +86,81 @@ func VisualizePacket(packet []byte) {
 	}
 
 	color.Cyan(">>>>--------------------------------------------------------------------<<<<")
+
+	if len(highlight) > 0 {
+		highlightColor.Printf("%d patched byte(s) highlighted\n", len(highlight))
+	}
+
+	warnStructure(packet)
+}
+
+// warnStructure flags anything about the packet's structure a parser might trip over,
+// such as header counts that don't match the sections actually present.
+func warnStructure(packet []byte) {
+	layout, err := wire.Walk(packet)
+	if err != nil {
+		color.Red("⚠️  WARNING: %v", err)
+		return
+	}
+
+	for _, mismatch := range layout.Mismatches() {
+		color.Red("⚠️  WARNING: Count mismatch: %s", mismatch)
+	}
+
+	for _, anomaly := range layout.PointerAnomalies(packet) {
+		color.Red("⚠️  WARNING: Malicious compression pointer: %s", anomaly)
+	}
+
+	if layout.Err != nil {
+		color.Red("⚠️  WARNING: Could not walk the full packet: %v", layout.Err)
+	} else if trailing := len(packet) - layout.End; trailing > 0 {
+		color.Red("⚠️  WARNING: %d trailing byte(s) after the last record", trailing)
+	}
+}
+
+// VisualizeTXTCapacity prints how the TXT records of a message are filled,
+// using the same capacity measure as the analyzer. Nothing is printed without TXT records.
+func VisualizeTXTCapacity(msg *dns.Msg) {
+	var rrs []dns.RR
+	rrs = append(rrs, msg.Answer...)
+	rrs = append(rrs, msg.Ns...)
+	rrs = append(rrs, msg.Extra...)
+
+	report := analyzer.TXTCapacityReport(rrs)
+	if len(report) == 0 {
+		return
+	}
+
+	color.Cyan("TXT capacity:")
+	totalBytes := 0
+	for i, txt := range report {
+		fmt.Printf("  %d. %s %d string(s), %d bytes, %.2f%% capacity\n", i+1, txt.Name, txt.Strings, txt.Bytes, txt.Capacity)
+		totalBytes += txt.Bytes
+	}
+	fmt.Printf("  Total: %d bytes in %d record(s)\n", totalBytes, len(report))
+}
+
+// VisualizeSize shows the size of the message on the wire against the limit of its size policy.
+func VisualizeSize(report crafter.SizeReport) {
+	color.Cyan("Size:")
+	fmt.Printf("  %d bytes on the wire, the limit is %d bytes (policy %s)\n", report.Final, report.Limit, report.Policy)
+
+	if report.Applied {
+		tc := "TC not set, only additional records were dropped"
+		if report.Truncated {
+			tc = "TC set"
+		}
+		color.Yellow("  Truncated from %d bytes: dropped %d answer, %d authority and %d additional record(s), %s",
+			report.Size, report.DroppedAnswers, report.DroppedAuthority, report.DroppedAdditional, tc)
+	}
+
+	switch {
+	case report.Over() && report.Policy == "oversize":
+		color.Yellow("  %d bytes over the limit, as intended", report.Final-report.Limit)
+	case report.Over():
+		// Even a strict policy can't stop patches (or a question that doesn't fit) from going over
+		color.Red("  ⚠️  %d bytes over the limit, the message may be dropped or cut short on the way", report.Final-report.Limit)
+	case report.Policy == "oversize":
+		color.Yellow("  ⚠️  Policy oversize, but the message fits within the limit")
+	}
 }
@@ -0,0 +1,94 @@
+package wire
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// headerFields maps the header anchors to their offsets, every header field is 2 bytes wide.
+var headerFields = map[string]int{
+	"id":      0,
+	"flags":   2,
+	"qdcount": 4,
+	"ancount": 6,
+	"nscount": 8,
+	"arcount": 10,
+}
+
+// anchorPattern matches anchors such as "header.flags", "question.qtype" or "answer[1].rdlength".
+// The index may be left out, in which case it defaults to 0.
+var anchorPattern = regexp.MustCompile(`^(?:header\.(\w+)|(question|answer|authority|additional)(?:\[(\d+)\])?\.(\w+))$`)
+
+// ValidAnchor reports whether anchor is well-formed and names a known field.
+// It doesn't check whether the question or record exists, that depends on the message.
+func ValidAnchor(anchor string) bool {
+	matches := anchorPattern.FindStringSubmatch(anchor)
+	if matches == nil {
+		return false
+	}
+	if matches[1] != "" {
+		_, ok := headerFields[matches[1]]
+		return ok
+	}
+	if matches[2] == "question" {
+		switch matches[4] {
+		case "name", "qname", "type", "qtype", "class", "qclass":
+			return true
+		}
+		return false
+	}
+	switch matches[4] {
+	case "name", "type", "class", "ttl", "rdlength", "rdata":
+		return true
+	}
+	return false
+}
+
+// Anchor returns the offset and width (in bytes) of the field named by anchor, e.g.
+// "header.flags", "question[0].qtype", "answer[1].ttl" or "additional[0].rdata".
+// Names are as long as their labels, or up to and including a pointer.
+func (l *Layout) Anchor(anchor string) (int, int, error) {
+	if !ValidAnchor(anchor) {
+		return 0, 0, fmt.Errorf("invalid anchor %q, expected e.g. header.flags, question[0].qtype or answer[0].rdlength", anchor)
+	}
+	matches := anchorPattern.FindStringSubmatch(anchor)
+
+	if matches[1] != "" {
+		return headerFields[matches[1]], 2, nil
+	}
+
+	index := matches[3]
+	if index == "" {
+		index = "0"
+	}
+	question, record, err := l.lookup(fmt.Sprintf("%s[%s]", matches[2], index))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if question != nil {
+		switch matches[4] {
+		case "name", "qname":
+			return question.NameOffset, question.TypeOffset - question.NameOffset, nil
+		case "type", "qtype":
+			return question.TypeOffset, 2, nil
+		default:
+			return question.ClassOffset, 2, nil
+		}
+	}
+
+	switch matches[4] {
+	case "name":
+		return record.NameOffset, record.TypeOffset - record.NameOffset, nil
+	case "type":
+		return record.TypeOffset, 2, nil
+	case "class":
+		return record.ClassOffset, 2, nil
+	case "ttl":
+		return record.TTLOffset, 4, nil
+	case "rdlength":
+		return record.RDLengthOffset, 2, nil
+	default:
+		return record.RDataOffset, record.End - record.RDataOffset, nil
+	}
+}
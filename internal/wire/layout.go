@@ -0,0 +1,243 @@
+// Package wire walks packed DNS messages byte-by-byte, without relying on miekg.
+// This lets us map out (and reason about) messages that miekg would refuse to
+// unpack, such as those with lying section counts or malicious pointers.
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// HeaderLength is the fixed length of the DNS header.
+const HeaderLength = 12
+
+// Counts holds the four section counts of a DNS message.
+type Counts struct {
+	QD uint16
+	AN uint16
+	NS uint16
+	AR uint16
+}
+
+// Question holds the offsets of the fields of a single question.
+type Question struct {
+	NameOffset  int
+	TypeOffset  int
+	ClassOffset int
+	End         int
+}
+
+// Record holds the offsets of the fields of a single resource record.
+type Record struct {
+	NameOffset     int
+	TypeOffset     int
+	ClassOffset    int
+	TTLOffset      int
+	RDLengthOffset int
+	RDataOffset    int
+	End            int
+}
+
+// Layout describes where every part of a packed DNS message lives.
+type Layout struct {
+	// Declared: The section counts as written in the header
+	Declared Counts
+
+	Questions  []Question
+	Answers    []Record
+	Authority  []Record
+	Additional []Record
+
+	// Extra: Records found after all the sections declared in the header
+	Extra []Record
+
+	// End: Offset right after the last question or record we could parse,
+	// anything beyond it is trailing data
+	End int
+
+	// Err: Why we stopped walking before the end of the message, if we did
+	Err error
+}
+
+// Walk maps out a packed DNS message. Sections are filled in the order declared
+// by the header counts, and we keep going for as long as the data allows, so
+// a count that lies in either direction shows up in the returned Layout.
+// An error is only returned if the message is too short to hold a header.
+func Walk(msg []byte) (*Layout, error) {
+	if len(msg) < HeaderLength {
+		return nil, fmt.Errorf("message is too short to be a valid DNS packet (%d bytes)", len(msg))
+	}
+
+	layout := &Layout{
+		Declared: Counts{
+			QD: binary.BigEndian.Uint16(msg[4:6]),
+			AN: binary.BigEndian.Uint16(msg[6:8]),
+			NS: binary.BigEndian.Uint16(msg[8:10]),
+			AR: binary.BigEndian.Uint16(msg[10:12]),
+		},
+		End: HeaderLength,
+	}
+
+	off := HeaderLength
+
+	for i := 0; i < int(layout.Declared.QD) && off < len(msg); i++ {
+		q, err := walkQuestion(msg, off)
+		if err != nil {
+			layout.Err = fmt.Errorf("question %d: %w", i, err)
+			return layout, nil
+		}
+		layout.Questions = append(layout.Questions, q)
+		off = q.End
+		layout.End = off
+	}
+
+	sections := []struct {
+		name    string
+		count   uint16
+		records *[]Record
+	}{
+		{"answer", layout.Declared.AN, &layout.Answers},
+		{"authority", layout.Declared.NS, &layout.Authority},
+		{"additional", layout.Declared.AR, &layout.Additional},
+	}
+
+	for _, section := range sections {
+		for i := 0; i < int(section.count) && off < len(msg); i++ {
+			r, err := walkRecord(msg, off)
+			if err != nil {
+				layout.Err = fmt.Errorf("%s %d: %w", section.name, i, err)
+				return layout, nil
+			}
+			*section.records = append(*section.records, r)
+			off = r.End
+			layout.End = off
+		}
+	}
+
+	// Anything left over might be records the header doesn't account for
+	for off < len(msg) {
+		r, err := walkRecord(msg, off)
+		if err != nil {
+			break
+		}
+		layout.Extra = append(layout.Extra, r)
+		off = r.End
+		layout.End = off
+	}
+
+	return layout, nil
+}
+
+// Present returns the number of questions and records actually found per section.
+func (l *Layout) Present() Counts {
+	return Counts{
+		QD: uint16(len(l.Questions)),
+		AN: uint16(len(l.Answers)),
+		NS: uint16(len(l.Authority)),
+		AR: uint16(len(l.Additional)),
+	}
+}
+
+// Mismatches describes every way in which the header counts don't match the
+// sections actually present. It returns nil if everything lines up.
+func (l *Layout) Mismatches() []string {
+	var mismatches []string
+
+	present := l.Present()
+	checks := []struct {
+		name              string
+		declared, present uint16
+	}{
+		{"QDCOUNT", l.Declared.QD, present.QD},
+		{"ANCOUNT", l.Declared.AN, present.AN},
+		{"NSCOUNT", l.Declared.NS, present.NS},
+		{"ARCOUNT", l.Declared.AR, present.AR},
+	}
+
+	for _, c := range checks {
+		if c.declared != c.present {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %d, but %d present", c.name, c.declared, c.present))
+		}
+	}
+
+	if len(l.Extra) > 0 {
+		mismatches = append(mismatches, fmt.Sprintf("%d record(s) found beyond the header counts", len(l.Extra)))
+	}
+
+	return mismatches
+}
+
+// walkQuestion maps a single question starting at off.
+func walkQuestion(msg []byte, off int) (Question, error) {
+	nameEnd, err := SkipName(msg, off)
+	if err != nil {
+		return Question{}, err
+	}
+	if nameEnd+4 > len(msg) {
+		return Question{}, fmt.Errorf("question is truncated at offset %d", nameEnd)
+	}
+
+	return Question{
+		NameOffset:  off,
+		TypeOffset:  nameEnd,
+		ClassOffset: nameEnd + 2,
+		End:         nameEnd + 4,
+	}, nil
+}
+
+// walkRecord maps a single resource record starting at off.
+func walkRecord(msg []byte, off int) (Record, error) {
+	nameEnd, err := SkipName(msg, off)
+	if err != nil {
+		return Record{}, err
+	}
+	if nameEnd+10 > len(msg) {
+		return Record{}, fmt.Errorf("record is truncated at offset %d", nameEnd)
+	}
+
+	rdLength := int(binary.BigEndian.Uint16(msg[nameEnd+8 : nameEnd+10]))
+	end := nameEnd + 10 + rdLength
+	if end > len(msg) {
+		return Record{}, fmt.Errorf("RDLENGTH of %d at offset %d runs past the end of the message", rdLength, nameEnd+8)
+	}
+
+	return Record{
+		NameOffset:     off,
+		TypeOffset:     nameEnd,
+		ClassOffset:    nameEnd + 2,
+		TTLOffset:      nameEnd + 4,
+		RDLengthOffset: nameEnd + 8,
+		RDataOffset:    nameEnd + 10,
+		End:            end,
+	}, nil
+}
+
+// SkipName returns the offset right after the (possibly compressed) name starting at off.
+// Pointers are not followed, so malicious pointers cannot trap us in a loop.
+func SkipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, fmt.Errorf("name runs past the end of the message")
+		}
+
+		length := int(msg[off])
+		switch length & 0xC0 {
+		case 0x00:
+			// a zero length label is the root, which ends the name
+			if length == 0 {
+				return off + 1, nil
+			}
+			off += 1 + length
+
+		case 0xC0:
+			// a pointer always ends the name
+			if off+2 > len(msg) {
+				return 0, fmt.Errorf("pointer at offset %d is truncated", off)
+			}
+			return off + 2, nil
+
+		default:
+			return 0, fmt.Errorf("unsupported label type 0x%02X at offset %d", length&0xC0, off)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package wire
+
+import (
+	"encoding/binary"
+	"github.com/miekg/dns"
+	"testing"
+)
+
+// packTest packs a message built from the given records, failing the test if it doesn't pack.
+// Answers are given in zone-file format, extra is appended to the packed message as-is.
+func packTest(t *testing.T, compress bool, answers []string, edns bool, extra ...byte) []byte {
+	t.Helper()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	msg.Response = true
+	msg.Compress = compress
+	for _, s := range answers {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", s, err)
+		}
+		msg.Answer = append(msg.Answer, rr)
+	}
+	if edns {
+		msg.SetEdns0(1232, true)
+	}
+
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack message: %v", err)
+	}
+	return append(raw, extra...)
+}
+
+// withCount overwrites one of the section counts of raw, idx 0 - 3 is QDCOUNT - ARCOUNT.
+func withCount(raw []byte, idx int, count uint16) []byte {
+	binary.BigEndian.PutUint16(raw[4+idx*2:], count)
+	return raw
+}
+
+func TestWalk(t *testing.T) {
+	answers := []string{
+		"www.example.com. 300 IN CNAME web.example.com.",
+		"web.example.com. 300 IN A 192.0.2.1",
+	}
+
+	tests := []struct {
+		name     string
+		raw      func(t *testing.T) []byte
+		declared Counts
+		present  Counts
+		extra    int
+		trailing int
+		err      bool
+	}{
+		{
+			name:     "plain",
+			raw:      func(t *testing.T) []byte { return packTest(t, false, answers, false) },
+			declared: Counts{QD: 1, AN: 2},
+			present:  Counts{QD: 1, AN: 2},
+		},
+		{
+			name:     "compressed",
+			raw:      func(t *testing.T) []byte { return packTest(t, true, answers, false) },
+			declared: Counts{QD: 1, AN: 2},
+			present:  Counts{QD: 1, AN: 2},
+		},
+		{
+			name:     "OPT record",
+			raw:      func(t *testing.T) []byte { return packTest(t, true, answers, true) },
+			declared: Counts{QD: 1, AN: 2, AR: 1},
+			present:  Counts{QD: 1, AN: 2, AR: 1},
+		},
+		{
+			name:     "count too low, the rest is extra",
+			raw:      func(t *testing.T) []byte { return withCount(packTest(t, true, answers, false), 1, 1) },
+			declared: Counts{QD: 1, AN: 1},
+			present:  Counts{QD: 1, AN: 1},
+			extra:    1,
+		},
+		{
+			name:     "count too high",
+			raw:      func(t *testing.T) []byte { return withCount(packTest(t, true, answers, false), 2, 4) },
+			declared: Counts{QD: 1, AN: 2, NS: 4},
+			present:  Counts{QD: 1, AN: 2},
+		},
+		{
+			name:     "trailing bytes",
+			raw:      func(t *testing.T) []byte { return packTest(t, true, answers, false, 0xde, 0xad, 0xbe) },
+			declared: Counts{QD: 1, AN: 2},
+			present:  Counts{QD: 1, AN: 2},
+			trailing: 3,
+		},
+		{
+			name: "truncated record",
+			raw: func(t *testing.T) []byte {
+				raw := packTest(t, false, answers, false)
+				return raw[:len(raw)-2]
+			},
+			declared: Counts{QD: 1, AN: 2},
+			present:  Counts{QD: 1, AN: 1},
+			trailing: 17 + 10 + 2, // The A record's owner name, its fixed fields and what's left of its RDATA
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.raw(t)
+
+			layout, err := Walk(raw)
+			if err != nil {
+				t.Fatalf("Walk failed: %v", err)
+			}
+			if layout.Declared != tt.declared {
+				t.Errorf("declared counts: got %+v, want %+v", layout.Declared, tt.declared)
+			}
+			if present := layout.Present(); present != tt.present {
+				t.Errorf("present counts: got %+v, want %+v", present, tt.present)
+			}
+			if len(layout.Extra) != tt.extra {
+				t.Errorf("extra records: got %d, want %d", len(layout.Extra), tt.extra)
+			}
+			if trailing := len(raw) - layout.End; trailing != tt.trailing {
+				t.Errorf("trailing bytes: got %d, want %d", trailing, tt.trailing)
+			}
+			if (layout.Err != nil) != tt.err {
+				t.Errorf("walk error: got %v, want an error: %t", layout.Err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWalkShort(t *testing.T) {
+	if _, err := Walk(make([]byte, HeaderLength-1)); err == nil {
+		t.Error("expected an error for a message shorter than the header")
+	}
+}
@@ -0,0 +1,139 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// refPattern matches references to a question or record, e.g. "question[0]" or "answer[2]".
+var refPattern = regexp.MustCompile(`^(question|answer|authority|additional)\[(\d+)\]$`)
+
+// NameOffset returns the offset of the owner name (or QNAME) of the question or
+// record referred to by ref, which has the form "question[0]", "answer[1]",
+// "authority[0]" or "additional[0]".
+func (l *Layout) NameOffset(ref string) (int, error) {
+	question, record, err := l.lookup(ref)
+	if err != nil {
+		return 0, err
+	}
+	if question != nil {
+		return question.NameOffset, nil
+	}
+	return record.NameOffset, nil
+}
+
+// lookup finds the question or record referred to by ref, exactly one of which is returned.
+func (l *Layout) lookup(ref string) (*Question, *Record, error) {
+	matches := refPattern.FindStringSubmatch(ref)
+	if matches == nil {
+		return nil, nil, fmt.Errorf("invalid reference %q, expected e.g. question[0] or answer[1]", ref)
+	}
+	index, _ := strconv.Atoi(matches[2])
+
+	if matches[1] == "question" {
+		if index >= len(l.Questions) {
+			return nil, nil, l.missing(fmt.Errorf("%s does not exist, there are %d question(s)", ref, len(l.Questions)))
+		}
+		return &l.Questions[index], nil, nil
+	}
+
+	records := l.Answers
+	switch matches[1] {
+	case "authority":
+		records = l.Authority
+	case "additional":
+		records = l.Additional
+	}
+
+	if index >= len(records) {
+		return nil, nil, l.missing(fmt.Errorf("%s does not exist, there are %d %s record(s)", ref, len(records), matches[1]))
+	}
+	return nil, &records[index], nil
+}
+
+// missing adds the reason the walk stopped early (if it did) to err,
+// since that's usually why a name can't be found.
+func (l *Layout) missing(err error) error {
+	if l.Err != nil {
+		return fmt.Errorf("%w (the message could only be walked up to offset %d: %v)", err, l.End, l.Err)
+	}
+	return err
+}
+
+// ValidRef reports whether ref is a well-formed question or record reference.
+func ValidRef(ref string) bool {
+	return refPattern.MatchString(ref)
+}
+
+// SkipLabels returns the offset right after the first n labels of the name starting at off.
+// It's an error if the name has fewer than n labels before its end or a pointer.
+func SkipLabels(msg []byte, off int, n int) (int, error) {
+	for i := 0; i < n; i++ {
+		if off >= len(msg) {
+			return 0, fmt.Errorf("name runs past the end of the message")
+		}
+		length := int(msg[off])
+		if length == 0 || length&0xC0 != 0 {
+			return 0, fmt.Errorf("name at offset %d has only %d label(s)", off, i)
+		}
+		off += 1 + length
+	}
+	return off, nil
+}
+
+// PointerAnomalies looks at every compression pointer in the question and owner
+// names and describes the ones a well-behaved server would never produce:
+// pointers to themselves or forward, into the header, or into the middle of a label.
+func (l *Layout) PointerAnomalies(msg []byte) []string {
+	var anomalies []string
+
+	var nameOffsets []int
+	for _, q := range l.Questions {
+		nameOffsets = append(nameOffsets, q.NameOffset)
+	}
+	for _, section := range [][]Record{l.Answers, l.Authority, l.Additional, l.Extra} {
+		for _, r := range section {
+			nameOffsets = append(nameOffsets, r.NameOffset)
+		}
+	}
+
+	// First collect every offset a label legitimately starts at
+	labelStarts := make(map[int]bool)
+	var pointers []int
+	for _, off := range nameOffsets {
+		for off < len(msg) {
+			length := int(msg[off])
+			if length&0xC0 == 0xC0 {
+				pointers = append(pointers, off)
+				break
+			}
+			labelStarts[off] = true
+			if length == 0 || length&0xC0 != 0 {
+				break
+			}
+			off += 1 + length
+		}
+	}
+
+	for _, off := range pointers {
+		if off+2 > len(msg) {
+			continue
+		}
+		target := int(binary.BigEndian.Uint16(msg[off:off+2]) & 0x3FFF)
+
+		switch {
+		case target == off:
+			anomalies = append(anomalies, fmt.Sprintf("pointer at 0x%04X points to itself (loop)", off))
+		case target > off:
+			anomalies = append(anomalies, fmt.Sprintf("pointer at 0x%04X points forward to 0x%04X", off, target))
+		case target < HeaderLength:
+			anomalies = append(anomalies, fmt.Sprintf("pointer at 0x%04X points into the header (0x%04X)", off, target))
+		case !labelStarts[target]:
+			anomalies = append(anomalies, fmt.Sprintf("pointer at 0x%04X points to 0x%04X, which is not the start of a label", off, target))
+		}
+	}
+
+	return anomalies
+}
@@ -0,0 +1,52 @@
+package wire
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnescapeTXT returns the bytes a TXT character-string in presentation format packs into,
+// following the rules miekg packs them by: \DDD is the byte with decimal value DDD, and a
+// backslash followed by anything else is that character as-is (e.g. \" or \\).
+func UnescapeTXT(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+
+		if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+			out = append(out, (s[i+1]-'0')*100+(s[i+2]-'0')*10+(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+		out = append(out, s[i+1])
+		i++
+	}
+	return out
+}
+
+// EscapeTXT returns the presentation format of the bytes of a TXT character-string, the way
+// miekg writes them: backslashes and quotes are escaped, and bytes that aren't printable
+// ASCII are written as \DDD. UnescapeTXT turns it back into the same bytes.
+func EscapeTXT(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '\\' || c == '"':
+			s.WriteByte('\\')
+			s.WriteByte(c)
+		case c < ' ' || c > '~':
+			s.WriteString(fmt.Sprintf("\\%03d", c))
+		default:
+			s.WriteByte(c)
+		}
+	}
+	return s.String()
+}
+
+// isDigit reports whether c is a decimal digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
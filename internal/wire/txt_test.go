@@ -0,0 +1,54 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnescapeTXT(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []byte
+	}{
+		{"plain", "hello", []byte("hello")},
+		{"decimal escapes", `a\000b\255`, []byte{'a', 0x00, 'b', 0xff}},
+		{"escaped quote and backslash", `\"\\`, []byte(`"\`)},
+		{"escaped character", `\a\.`, []byte("a.")},
+		{"too few digits", `\12x`, []byte("12x")},
+		{"trailing backslash", `ab\`, []byte(`ab\`)},
+		{"empty", "", []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnescapeTXT(tt.in); !bytes.Equal(got, tt.want) {
+				t.Errorf("UnescapeTXT(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeTXT(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"plain", []byte("hello world"), "hello world"},
+		{"quote and backslash", []byte(`"\`), `\"\\`},
+		{"binary", []byte{0x00, 0x1f, 0x7f, 0xff}, `\000\031\127\255`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EscapeTXT(tt.in)
+			if got != tt.want {
+				t.Errorf("EscapeTXT(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if back := UnescapeTXT(got); !bytes.Equal(back, tt.in) {
+				t.Errorf("UnescapeTXT(%q) = %q, want the original %q", got, back, tt.in)
+			}
+		})
+	}
+}